@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/swapsched"
+)
+
+// 进程结束的方式
+const (
+	terminationExited   = "exited"    // 退出码为 0
+	terminationExitCode = "exit-code" // 以非 0 值退出
+	terminationSignal   = "signal"
+	terminationOOMKill  = "oom-kill"
+)
+
+const (
+	signalAppCrashed = "AppCrashed"
+
+	// systemd-coredump 在日志中记录 core dump 时使用的 MESSAGE_ID
+	coredumpMessageId = "fc2e22bc6ee647b6b90729ab34a250b1"
+	coredumpDir       = "/var/lib/systemd/coredump"
+
+	// 进程退出时 systemd-coredump 可能还没有写完，多次查找
+	coredumpLookupRetries  = 5
+	coredumpLookupInterval = time.Second
+)
+
+// classifyTermination 返回进程结束的方式，cgroup 中的其他进程也可能被 OOM killer 杀死，
+// 所以只有进程本身被 SIGKILL 杀死时才算 oom-kill
+func classifyTermination(exitCode, signal int, oomKilled bool) string {
+	switch {
+	case oomKilled && signal == int(syscall.SIGKILL):
+		return terminationOOMKill
+	case signal != 0:
+		return terminationSignal
+	case exitCode != 0:
+		return terminationExitCode
+	}
+	return terminationExited
+}
+
+// isCrash 返回进程是否崩溃，被 OOM killer 杀死也算崩溃，用户或会话主动发送的信号不算
+func isCrash(termination string, signal int) bool {
+	switch termination {
+	case terminationOOMKill:
+		return true
+	case terminationSignal:
+		return !isIntentionalSignal(signal)
+	}
+	return false
+}
+
+// isCoreDumpSignal 返回信号的默认动作是否会产生 core dump
+func isCoreDumpSignal(signal int) bool {
+	switch syscall.Signal(signal) {
+	case syscall.SIGQUIT, syscall.SIGILL, syscall.SIGTRAP, syscall.SIGABRT, syscall.SIGBUS,
+		syscall.SIGFPE, syscall.SIGSEGV, syscall.SIGSYS, syscall.SIGXCPU, syscall.SIGXFSZ:
+		return true
+	}
+	return false
+}
+
+// getOOMKillCount 读取 cgroup v2 的 memory.events 或 v1 的 memory.oom_control 中的 oom_kill 计数
+func getOOMKillCount(dir string) (uint64, error) {
+	var lastErr error
+	for _, name := range []string{"memory.events", "memory.oom_control"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "oom_kill" {
+				return strconv.ParseUint(fields[1], 10, 64)
+			}
+		}
+		return 0, fmt.Errorf("no oom_kill in %s", name)
+	}
+	return 0, lastErr
+}
+
+// oomWatcher 比较应用 cgroup 在启动和退出时的 oom_kill 计数，
+// scope 的 cgroup 在进程退出后可能已经被删除，此时使用 scope 单元的 Result
+type oomWatcher struct {
+	dir   string
+	count uint64
+	scope *appScopeUnit
+}
+
+func newOOMWatcher(cgroupDir string, scope *appScopeUnit) *oomWatcher {
+	w := &oomWatcher{scope: scope}
+	if cgroupDir != "" {
+		count, err := getOOMKillCount(cgroupDir)
+		if err != nil {
+			logger.Debug("failed to get oom_kill count:", err)
+		} else {
+			w.dir = cgroupDir
+			w.count = count
+		}
+	}
+	if w.dir == "" && w.scope == nil {
+		return nil
+	}
+	return w
+}
+
+func (w *oomWatcher) killed() bool {
+	if w == nil {
+		return false
+	}
+	var killed bool
+	if w.scope != nil {
+		result, err := w.scope.release()
+		if err != nil {
+			logger.Debug("failed to get scope result:", err)
+		} else {
+			killed = result == scopeResultOOMKill
+		}
+	}
+	if w.dir != "" && !killed {
+		count, err := getOOMKillCount(w.dir)
+		if err != nil {
+			logger.Debug("failed to get oom_kill count:", err)
+		} else {
+			killed = count > w.count
+		}
+	}
+	return killed
+}
+
+// getProcMemoryCgroup 从 /proc/<pid>/cgroup 取出进程所在的 cgroup 路径，v2 使用统一层级，v1 使用 memory 层级
+func getProcMemoryCgroup(procCgroupFile string, unified bool) (string, error) {
+	f, err := os.Open(procCgroupFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if unified && parts[0] == "0" && parts[1] == "" {
+			return parts[2], nil
+		}
+		for _, ctl := range strings.Split(parts[1], ",") {
+			if !unified && ctl == "memory" {
+				return parts[2], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no memory cgroup in %s", procCgroupFile)
+}
+
+// getMemoryCgroup 返回只包含本应用进程的 cgroup 目录，DE 组件所在的公共 cgroup 返回空
+func (app *launchedApp) getMemoryCgroup(pid int) string {
+	var name string
+	if app.uiApp != nil {
+		name = app.uiApp.GetCGroup()
+	} else if app.scope != "" {
+		cgroupPath, err := getProcMemoryCgroup(fmt.Sprintf("/proc/%d/cgroup", pid),
+			swapsched.IsUnifiedCgroup())
+		if err != nil || filepath.Base(cgroupPath) != app.scope {
+			return ""
+		}
+		name = cgroupPath
+	}
+	if name == "" {
+		return ""
+	}
+	return filepath.Dir(swapsched.GetCgroupProcsFile(name))
+}
+
+// getBootId 返回本次启动的 boot id，格式与 systemd-coredump 的文件名中的相同，即去掉 - 的 128 位十六进制数
+func getBootId() (string, error) {
+	content, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(strings.TrimSpace(string(content)), "-", "", -1), nil
+}
+
+// findCoredumpInJournal 在本次启动的 systemd-coredump 日志中查找 since 之后 pid 的 core dump 文件，since 为毫秒
+func findCoredumpInJournal(pid int, since int64) string {
+	out, err := exec.Command("journalctl", "-o", "json", "--no-pager", "-b", "-n", "1",
+		fmt.Sprintf("--since=@%d", since/1000),
+		"MESSAGE_ID="+coredumpMessageId, "COREDUMP_PID="+strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	var entry struct {
+		Filename string `json:"COREDUMP_FILENAME"`
+	}
+	line := strings.TrimSpace(string(out))
+	if line == "" || json.Unmarshal([]byte(line), &entry) != nil {
+		return ""
+	}
+	return entry.Filename
+}
+
+// findCoredumpFile 按 systemd-coredump 的文件名 core.<comm>.<uid>.<boot id>.<pid>.<微秒时间>[.压缩格式] 查找，
+// 只查找本次启动中 since 之后的文件，since 为毫秒，pid 被重用时取最新的
+func findCoredumpFile(dir string, uid int, bootId string, pid int, since int64) string {
+	infix := fmt.Sprintf(".%d.%s.%d.", uid, bootId, pid)
+	matches, err := filepath.Glob(filepath.Join(dir, "core.*"+infix+"*"))
+	if err != nil {
+		return ""
+	}
+	var found string
+	var foundTime uint64
+	for _, match := range matches {
+		name := filepath.Base(match)
+		rest := name[strings.LastIndex(name, infix)+len(infix):]
+		usec, err := strconv.ParseUint(strings.SplitN(rest, ".", 2)[0], 10, 64)
+		if err != nil || int64(usec/1000) < since {
+			continue
+		}
+		if found == "" || usec > foundTime {
+			found = match
+			foundTime = usec
+		}
+	}
+	return found
+}
+
+func findCoredump(pid int, since int64) string {
+	path := findCoredumpInJournal(pid, since)
+	if path == "" {
+		bootId, err := getBootId()
+		if err != nil {
+			logger.Warning(err)
+			return ""
+		}
+		path = findCoredumpFile(coredumpDir, os.Getuid(), bootId, pid, since)
+	}
+	return path
+}
+
+// handleAppCrash 查找 core dump 后发送 AppCrashed 信号
+func (m *StartManager) handleAppCrash(app *launchedApp, rec *AppLaunchRecord) {
+	var coredumpPath string
+	if rec.Termination == terminationSignal && isCoreDumpSignal(rec.Signal) {
+		for i := 0; i < coredumpLookupRetries; i++ {
+			time.Sleep(coredumpLookupInterval)
+			coredumpPath = findCoredump(rec.Pid, rec.StartTime)
+			if coredumpPath != "" {
+				break
+			}
+		}
+	}
+
+	logger.Warningf("app %s (pid %d) crashed, %s %d, core dump %q", app.id, rec.Pid,
+		rec.Termination, rec.Signal, coredumpPath)
+	err := m.service.Emit(m, signalAppCrashed, app.id, uint32(rec.Pid), int32(rec.Signal), coredumpPath)
+	if err != nil {
+		logger.Warning("failed to emit signal AppCrashed:", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_classifyTermination(t *testing.T) {
+	assert.Equal(t, terminationExited, classifyTermination(0, 0, false))
+	assert.Equal(t, terminationExitCode, classifyTermination(1, 0, false))
+	assert.Equal(t, terminationSignal, classifyTermination(-1, int(syscall.SIGSEGV), false))
+	assert.Equal(t, terminationOOMKill, classifyTermination(-1, int(syscall.SIGKILL), true))
+	// cgroup 中的其他进程被 OOM killer 杀死
+	assert.Equal(t, terminationExited, classifyTermination(0, 0, true))
+	assert.Equal(t, terminationSignal, classifyTermination(-1, int(syscall.SIGTERM), true))
+}
+
+func Test_isCrash(t *testing.T) {
+	assert.False(t, isCrash(terminationExited, 0))
+	assert.False(t, isCrash(terminationExitCode, 0))
+	assert.True(t, isCrash(terminationSignal, int(syscall.SIGSEGV)))
+	assert.True(t, isCrash(terminationSignal, int(syscall.SIGABRT)))
+	assert.False(t, isCrash(terminationSignal, int(syscall.SIGTERM)))
+	assert.True(t, isCrash(terminationOOMKill, int(syscall.SIGKILL)))
+}
+
+func Test_getOOMKillCount(t *testing.T) {
+	count, err := getOOMKillCount("testdata/app_crash/v1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), count)
+
+	count, err = getOOMKillCount("testdata/app_crash/v2")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	_, err = getOOMKillCount("testdata/app_crash/notexist")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, newOOMWatcher("", nil))
+	assert.Nil(t, newOOMWatcher("testdata/app_crash/notexist", nil))
+	var w *oomWatcher
+	assert.False(t, w.killed())
+	w = newOOMWatcher("testdata/app_crash/v2", nil)
+	assert.False(t, w.killed())
+	w.count = 0
+	assert.True(t, w.killed())
+}
+
+func Test_getProcMemoryCgroup(t *testing.T) {
+	cgroupPath, err := getProcMemoryCgroup("testdata/app_crash/cgroup-v2", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "/user.slice/user-1000.slice/user@1000.service/app.slice/app-deepin-music-1.scope",
+		cgroupPath)
+
+	cgroupPath, err = getProcMemoryCgroup("testdata/app_crash/cgroup-v1", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "/1000@dde/uiapps/3", cgroupPath)
+
+	_, err = getProcMemoryCgroup("testdata/app_crash/cgroup-v2", false)
+	assert.NotNil(t, err)
+}
+
+func Test_findCoredumpFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-coredump")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{
+		"core.deepin-music.1000.0a1b2c.4321.1602460000000000.zst",
+		"core.deepin-music.1001.0a1b2c.1234.1602460000000000.zst",
+		"core.Deepin.music.1000.0a1b2c.1234.1602460000000000.zst",
+		"core.deepin-music.1000.0a1b2c.1234.1602450000000000.zst",
+		"core.deepin-music.1000.9f8e7d.1234.1602470000000000.zst",
+		"core.deepin-music.1000.0a1b2c.1234.1602440000000000",
+	}
+	for _, name := range names {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	// 取时间最新的，其他启动中的 core dump 不算
+	assert.Equal(t, filepath.Join(dir, names[2]),
+		findCoredumpFile(dir, 1000, "0a1b2c", 1234, 0))
+	// 应用启动之前的 core dump 不算
+	assert.Equal(t, filepath.Join(dir, names[2]),
+		findCoredumpFile(dir, 1000, "0a1b2c", 1234, 1602455000000))
+	assert.Equal(t, "", findCoredumpFile(dir, 1000, "0a1b2c", 1234, 1602460000001))
+	assert.Equal(t, "", findCoredumpFile(dir, 1000, "0a1b2c", 5678, 0))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/keyfile"
+)
+
+// launched 和 exited 目录中的 hook 按文件名顺序依次执行，参数为 desktop 文件和 cgroup 名，
+// 标准输入为 JSON 格式的 appHookPayload。每个 hook 的超时时间可以在 hooks.conf 中设置:
+//
+//	[launched]
+//	10-firewall=5
+const (
+	exitedHookDir   = uiAppSchedHooksDir + "/exited"
+	hooksConfigFile = uiAppSchedHooksDir + "/hooks.conf"
+
+	hookEventLaunched = "launched"
+	hookEventExited   = "exited"
+
+	defaultHookTimeout = 10 * time.Second
+	// 失败时最多记录的输出字节数
+	hookMaxOutput = 4096
+)
+
+type appHookPayload struct {
+	Event       string
+	AppId       string
+	DesktopFile string
+	Pid         int
+	CGroup      string
+	Limits      *swapsched.AppResourcesLimit `json:",omitempty"`
+	Options     map[string]interface{}       `json:",omitempty"`
+	Timestamp   int64                        // unix time in milliseconds
+	ExitCode    *int                         `json:",omitempty"`
+	Signal      int                          `json:",omitempty"`
+}
+
+func newAppHookPayload(event string, app *launchedApp, rec *AppLaunchRecord) *appHookPayload {
+	payload := &appHookPayload{
+		Event:       event,
+		DesktopFile: rec.DesktopFile,
+		Pid:         rec.Pid,
+		CGroup:      rec.CGroup,
+		Limits:      app.limit,
+		Timestamp:   toMilliseconds(time.Now()),
+	}
+	if app.appInfo != nil {
+		payload.AppId = app.appInfo.GetId()
+	}
+	if app.opts != nil {
+		options := app.opts.toMap()
+		if len(options) > 0 {
+			payload.Options = options
+		}
+	}
+	if event == hookEventExited {
+		exitCode := rec.ExitCode
+		payload.ExitCode = &exitCode
+		payload.Signal = rec.Signal
+	}
+	return payload
+}
+
+// loadHookTimeouts 返回 hooks.conf 中各 hook 的超时时间，key 为 event/hook
+func loadHookTimeouts(filename string) map[string]time.Duration {
+	ret := make(map[string]time.Duration)
+	kf := keyfile.NewKeyFile()
+	err := kf.LoadFromFile(filename)
+	if err != nil {
+		return ret
+	}
+	for _, event := range []string{hookEventLaunched, hookEventExited} {
+		for _, name := range kf.GetKeys(event) {
+			seconds, err := kf.GetInt(event, name)
+			if err != nil || seconds <= 0 {
+				logger.Warningf("invalid timeout of hook %s/%s", event, name)
+				continue
+			}
+			ret[event+"/"+name] = time.Duration(seconds) * time.Second
+		}
+	}
+	return ret
+}
+
+func getHookTimeout(timeouts map[string]time.Duration, event, name string) time.Duration {
+	if timeout, ok := timeouts[event+"/"+name]; ok {
+		return timeout
+	}
+	return defaultHookTimeout
+}
+
+// newUnlinkedTempFile 创建已经删除了文件名的临时文件，写入 content 后回到开头
+func newUnlinkedTempFile(content []byte) (*os.File, error) {
+	f, err := ioutil.TempFile("", "startdde-hook")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name())
+	_, err = f.Write(content)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// runHook 在独立的进程组中运行 hook，超时后杀死整个进程组，避免 hook 的子进程阻塞。
+// 标准输入输出使用文件而不是管道，脱离进程组的子进程继续持有它们时 Wait 也能在 hook 退出后返回
+func runHook(path string, args []string, input []byte, timeout time.Duration) error {
+	stdin, err := newUnlinkedTempFile(input)
+	if err != nil {
+		return err
+	}
+	defer stdin.Close()
+	output, err := newUnlinkedTempFile(nil)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	var timedOut int32
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err = cmd.Wait()
+	timer.Stop()
+	if atomic.LoadInt32(&timedOut) == 1 {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		content, _ := ioutil.ReadAll(io.NewSectionReader(output, 0, hookMaxOutput))
+		content = bytes.TrimSpace(content)
+		if len(content) > 0 {
+			logger.Warningf("hook %s output: %s", path, content)
+		}
+	}
+	return err
+}
+
+// runHooks 按顺序执行 dir 中的 hook，一个 hook 失败不影响后面的 hook
+func runHooks(dir string, hooks []string, timeouts map[string]time.Duration, payload *appHookPayload) {
+	if len(hooks) == 0 {
+		return
+	}
+	input, err := json.Marshal(payload)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	args := []string{payload.DesktopFile, payload.CGroup}
+	for _, name := range hooks {
+		timeout := getHookTimeout(timeouts, payload.Event, name)
+		err := runHook(filepath.Join(dir, name), args, input, timeout)
+		if err != nil {
+			logger.Warningf("%s hook %s for %s failed: %v", payload.Event, name, payload.DesktopFile, err)
+		}
+	}
+}
+
+func (m *StartManager) execHooks(event string, payload *appHookPayload) {
+	switch event {
+	case hookEventLaunched:
+		runHooks(launchedHookDir, m.launchedHooks, m.hookTimeouts, payload)
+	case hookEventExited:
+		runHooks(exitedHookDir, m.exitedHooks, m.hookTimeouts, payload)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pkg.deepin.io/dde/startdde/swapsched"
+)
+
+func Test_loadHookTimeouts(t *testing.T) {
+	timeouts := loadHookTimeouts("testdata/app_hooks/hooks.conf")
+	assert.Equal(t, map[string]time.Duration{
+		"launched/10-firewall": 3 * time.Second,
+		"exited/10-firewall":   5 * time.Second,
+	}, timeouts)
+	assert.Equal(t, 5*time.Second, getHookTimeout(timeouts, hookEventExited, "10-firewall"))
+	assert.Equal(t, defaultHookTimeout, getHookTimeout(timeouts, hookEventExited, "20-vpn"))
+
+	assert.Empty(t, loadHookTimeouts("testdata/app_hooks/notexist.conf"))
+}
+
+func Test_newAppHookPayload(t *testing.T) {
+	app := &launchedApp{
+		opts:  &launchOptions{dir: "/tmp"},
+		limit: &swapsched.AppResourcesLimit{MemHardLimit: 1024},
+	}
+	rec := &AppLaunchRecord{
+		DesktopFile: "/usr/share/applications/deepin-music.desktop",
+		Pid:         100,
+		CGroup:      "1@dde/uiapps/3",
+		ExitCode:    1,
+	}
+
+	payload := newAppHookPayload(hookEventLaunched, app, rec)
+	assert.Equal(t, hookEventLaunched, payload.Event)
+	assert.Equal(t, 100, payload.Pid)
+	assert.Equal(t, "1@dde/uiapps/3", payload.CGroup)
+	assert.Equal(t, map[string]interface{}{launchOptionDir: "/tmp"}, payload.Options)
+	assert.Nil(t, payload.ExitCode)
+
+	payload = newAppHookPayload(hookEventExited, app, rec)
+	if assert.NotNil(t, payload.ExitCode) {
+		assert.Equal(t, 1, *payload.ExitCode)
+	}
+}
+
+func Test_runHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-hooks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	hooks := map[string]string{
+		"10-first":  "#!/bin/sh\necho \"$0 $1 $2\" >> " + out + "\ncat >> " + out + "\necho >> " + out + "\n",
+		"20-fail":   "#!/bin/sh\necho failed\nexit 1\n",
+		"30-slow":   "#!/bin/sh\nsleep 5\necho slow >> " + out + "\n",
+		"40-second": "#!/bin/sh\necho second >> " + out + "\n",
+	}
+	for name, content := range hooks {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0755)
+		if !assert.Nil(t, err) {
+			return
+		}
+	}
+
+	payload := &appHookPayload{
+		Event:       hookEventExited,
+		DesktopFile: "a.desktop",
+		CGroup:      "cg",
+		Pid:         42,
+	}
+	timeouts := map[string]time.Duration{"exited/30-slow": 100 * time.Millisecond}
+	runHooks(dir, getLaunchedHooks(dir), timeouts, payload)
+
+	content, err := ioutil.ReadFile(out)
+	if !assert.Nil(t, err) {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, "10-first")+" a.desktop cg", lines[0])
+	var got appHookPayload
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &got))
+	assert.Equal(t, *payload, got)
+	assert.Equal(t, "second", lines[2])
+}
+
+func Test_runHookDetachedChild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-hooks")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// 脱离进程组的子进程继续持有 hook 的标准输出
+	hook := filepath.Join(dir, "10-detach")
+	err = ioutil.WriteFile(hook, []byte("#!/bin/sh\nsetsid sleep 5 &\necho failed\nexit 1\n"), 0755)
+	if !assert.Nil(t, err) {
+		return
+	}
+	start := time.Now()
+	assert.NotNil(t, runHook(hook, nil, []byte("{}"), time.Second))
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const appJournalMaxRecords = 500
+
+// AppLaunchRecord 记录一次由 StartManager 启动的进程的生命周期
+type AppLaunchRecord struct {
+	DesktopFile string
+	Command     []string
+	Pid         int
+	CGroup      string
+	StartTime   int64 // unix time in milliseconds
+	ExitTime    int64 // unix time in milliseconds, 0 means still running
+	ExitCode    int
+	Signal      int    // terminating signal, 0 means exited normally
+	Termination string `json:",omitempty"` // exited, exit-code, signal 或 oom-kill，见 app_crash.go
+	AutoRestart bool
+	// 通过 org.freedesktop.Application 启动时为调用的方法，此时没有进程信息
+	Activation string `json:",omitempty"`
+}
+
+func (r *AppLaunchRecord) name() string {
+	if r.DesktopFile != "" {
+		return r.DesktopFile
+	}
+	return strings.Join(r.Command, " ")
+}
+
+type appJournal struct {
+	mu      sync.Mutex
+	records []*AppLaunchRecord
+	file    string
+}
+
+// 匹配 URL 中的 :password@
+var urlPasswordRegexp = regexp.MustCompile(`(://[^/@:\s]*):[^/@\s]*@`)
+
+// redactCommand 隐藏命令参数中 URL 包含的密码
+func redactCommand(args []string) []string {
+	ret := make([]string, len(args))
+	for i, arg := range args {
+		ret[i] = urlPasswordRegexp.ReplaceAllString(arg, "${1}:***@")
+	}
+	return ret
+}
+
+func getAppJournalFile() string {
+	return filepath.Join(basedir.GetUserCacheDir(), "deepin", "startdde", "app-journal.log")
+}
+
+// newAppJournal 创建本次会话的启动日志，上一次会话的日志保存为 file.old
+func newAppJournal(file string) *appJournal {
+	if file != "" {
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			logger.Warning(err)
+		}
+		err = os.Rename(file, file+".old")
+		if err == nil {
+			// 旧版本创建的日志所有人都可以读
+			err = os.Chmod(file+".old", 0600)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			logger.Warning("failed to rotate app journal:", err)
+		}
+	}
+	return &appJournal{file: file}
+}
+
+func (j *appJournal) addLaunch(desktopFile string, cmd *exec.Cmd, cGroupName string,
+	autoRestart bool) *AppLaunchRecord {
+
+	rec := &AppLaunchRecord{
+		DesktopFile: desktopFile,
+		Command:     redactCommand(cmd.Args),
+		CGroup:      cGroupName,
+		StartTime:   toMilliseconds(time.Now()),
+		AutoRestart: autoRestart,
+	}
+	if cmd.Process != nil {
+		rec.Pid = cmd.Process.Pid
+	}
+	j.add(rec)
+	return rec
+}
+
+// addActivation 记录通过 D-Bus 启动的应用，应用由 dbus-daemon 或已运行的实例处理，不会记录退出
+func (j *appJournal) addActivation(desktopFile, method string) *AppLaunchRecord {
+	rec := &AppLaunchRecord{
+		DesktopFile: desktopFile,
+		StartTime:   toMilliseconds(time.Now()),
+		Activation:  method,
+	}
+	j.add(rec)
+	return rec
+}
+
+func (j *appJournal) add(rec *AppLaunchRecord) {
+	j.mu.Lock()
+	j.records = append(j.records, rec)
+	if len(j.records) > appJournalMaxRecords {
+		j.records = j.records[len(j.records)-appJournalMaxRecords:]
+	}
+	j.appendToFile(rec)
+	j.mu.Unlock()
+}
+
+func (j *appJournal) setExited(rec *AppLaunchRecord, state *os.ProcessState, oomKilled bool) {
+	j.mu.Lock()
+	rec.ExitTime = toMilliseconds(time.Now())
+	rec.ExitCode, rec.Signal = getExitStatus(state)
+	rec.Termination = classifyTermination(rec.ExitCode, rec.Signal, oomKilled)
+	j.appendToFile(rec)
+	j.mu.Unlock()
+}
+
+// appendToFile 需要在持有 j.mu 的情况下调用
+func (j *appJournal) appendToFile(rec *AppLaunchRecord) {
+	if j.file == "" {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	f, err := os.OpenFile(j.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Warning("failed to open app journal:", err)
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		logger.Warning("failed to write app journal:", err)
+	}
+	err = f.Close()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// dump 返回 since(unix 毫秒时间)之后启动的记录，since 为 0 则返回全部
+func (j *appJournal) dump(since int64) ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	records := make([]*AppLaunchRecord, 0, len(j.records))
+	for _, rec := range j.records {
+		if rec.StartTime >= since {
+			records = append(records, rec)
+		}
+	}
+	return json.Marshal(records)
+}
+
+// getRunningPids 返回由 desktopFile 启动且尚未退出的进程
+func (j *appJournal) getRunningPids(desktopFile string) []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var pids []int
+	for _, rec := range j.records {
+		if rec.DesktopFile == desktopFile && rec.ExitTime == 0 && rec.Pid > 0 {
+			pids = append(pids, rec.Pid)
+		}
+	}
+	return pids
+}
+
+func getExitStatus(state *os.ProcessState) (exitCode, signal int) {
+	if state == nil {
+		return -1, 0
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return -1, int(ws.Signal())
+	}
+	return state.ExitCode(), 0
+}
+
+func toMilliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
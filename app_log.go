@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+// 应用的标准输出和标准错误默认保存到 $XDG_STATE_HOME/startdde/apps/<app-id>.log，
+// 也可以通过 GSettings 的 app-log-mode 转发到 journald 或者不捕获
+const (
+	gKeyAppLogMode = "app-log-mode"
+
+	appLogModeFile    = "file"
+	appLogModeJournal = "journal"
+	appLogModeNone    = "none"
+
+	// 日志文件超过 appLogMaxSize 时轮转，保留 appLogMaxFiles 个旧文件 <app-id>.log.1 ~ .3
+	appLogMaxSize  = 1024 * 1024
+	appLogMaxFiles = 3
+
+	appLogMaxTailLines = 10000
+	// 超过此长度的行分成多行写入，避免不换行的输出占用大量内存
+	appLogMaxLineLen = 4096
+
+	journalSocket = "/run/systemd/journal/socket"
+)
+
+func isValidAppLogMode(mode string) bool {
+	return mode == appLogModeFile || mode == appLogModeJournal || mode == appLogModeNone
+}
+
+func getAppLogDir() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		stateDir = filepath.Join(basedir.GetUserHomeDir(), ".local/state")
+	}
+	return filepath.Join(stateDir, "startdde/apps")
+}
+
+// getAppLogId 返回用于日志文件名的 id，子目录中 desktop 文件的 id 可能包含 /
+func getAppLogId(appId string) string {
+	return strings.Replace(appId, "/", "-", -1)
+}
+
+// rotatingLog 是大小受限的日志文件，写入前超过限制就轮转
+type rotatingLog struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func newRotatingLog(path string, maxSize int64, maxFiles int) *rotatingLog {
+	return &rotatingLog{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+}
+
+func (l *rotatingLog) rotatedPath(i int) string {
+	if i == 0 {
+		return l.path
+	}
+	return l.path + "." + strconv.Itoa(i)
+}
+
+// open 打开日志文件，输出中可能包含敏感信息，只有用户自己可以读取
+func (l *rotatingLog) open() error {
+	err := os.MkdirAll(filepath.Dir(l.path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	// 以前创建的文件权限可能是 0644
+	err = f.Chmod(0600)
+	if err != nil {
+		logger.Warning(err)
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = fileInfo.Size()
+	return nil
+}
+
+func (l *rotatingLog) rotate() error {
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	for i := l.maxFiles; i > 0; i-- {
+		err := os.Rename(l.rotatedPath(i-1), l.rotatedPath(i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return l.open()
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		err := l.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		err := l.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	if err != nil {
+		// 下次写入时重新打开文件
+		l.f.Close()
+		l.f = nil
+	}
+	return n, err
+}
+
+// tail 返回最后 n 行，从当前文件开始向旧文件读取
+func (l *rotatingLog) tail(n int) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var lines []string
+	for i := 0; i <= l.maxFiles && len(lines) < n; i++ {
+		content, err := ioutil.ReadFile(l.rotatedPath(i))
+		if err != nil {
+			if os.IsNotExist(err) {
+				if i == 0 {
+					continue
+				}
+				break
+			}
+			return nil, err
+		}
+		content = bytes.TrimSuffix(content, []byte("\n"))
+		if len(content) == 0 {
+			continue
+		}
+		fileLines := strings.Split(string(content), "\n")
+		lines = append(fileLines, lines...)
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// journalWriter 通过 journald 的原生协议发送日志，每行一条，带有 APP_ID 字段
+type journalWriter struct {
+	conn  *net.UnixConn
+	appId string
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	line := bytes.TrimSuffix(p, []byte("\n"))
+	buf.WriteString("MESSAGE=")
+	buf.Write(line)
+	buf.WriteString("\nPRIORITY=6\nSYSLOG_IDENTIFIER=" + w.appId + "\nAPP_ID=" + w.appId + "\n")
+	_, err := w.conn.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type appLogManager struct {
+	mu      sync.Mutex
+	mode    string
+	dir     string
+	logs    map[string]*rotatingLog
+	journal *net.UnixConn
+}
+
+func newAppLogManager(mode, dir string) *appLogManager {
+	if !isValidAppLogMode(mode) {
+		if mode != "" {
+			logger.Warningf("invalid app log mode %q", mode)
+		}
+		mode = appLogModeFile
+	}
+	return &appLogManager{
+		mode: mode,
+		dir:  dir,
+		logs: make(map[string]*rotatingLog),
+	}
+}
+
+func (lm *appLogManager) getLog(appId string) *rotatingLog {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	appId = getAppLogId(appId)
+	l, ok := lm.logs[appId]
+	if !ok {
+		l = newRotatingLog(filepath.Join(lm.dir, appId+".log"), appLogMaxSize, appLogMaxFiles)
+		lm.logs[appId] = l
+	}
+	return l
+}
+
+func (lm *appLogManager) getWriter(appId string) (io.Writer, error) {
+	if lm.mode != appLogModeJournal {
+		return lm.getLog(appId), nil
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if lm.journal == nil {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+		if err != nil {
+			return nil, err
+		}
+		lm.journal = conn
+	}
+	return &journalWriter{conn: lm.journal, appId: getAppLogId(appId)}, nil
+}
+
+// resetJournal 在写入 journald 失败后关闭连接，下次获取写入端时重新连接
+func (lm *appLogManager) resetJournal(conn *net.UnixConn) {
+	lm.mu.Lock()
+	if lm.journal == conn {
+		lm.journal.Close()
+		lm.journal = nil
+	}
+	lm.mu.Unlock()
+}
+
+// consume 按行把 r 中的输出写入应用的日志，直到所有写端关闭，
+// 写入失败时丢弃这一行，下一行重新获取写入端再写入，始终读取以免应用写满管道后阻塞
+func (lm *appLogManager) consume(appId string, r io.ReadCloser) {
+	defer r.Close()
+	var w io.Writer
+	var failed bool
+	br := bufio.NewReaderSize(r, appLogMaxLineLen)
+	buf := make([]byte, 0, appLogMaxLineLen+1)
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// 过长的行分成多行写入
+			err = nil
+		}
+		if len(line) > 0 {
+			// line 引用 br 的缓冲区，复制后再添加换行符
+			buf = append(buf[:0], line...)
+			if buf[len(buf)-1] != '\n' {
+				buf = append(buf, '\n')
+			}
+			var werr error
+			if w == nil {
+				w, werr = lm.getWriter(appId)
+			}
+			if werr == nil {
+				_, werr = w.Write(buf)
+				if werr != nil {
+					if jw, ok := w.(*journalWriter); ok {
+						lm.resetJournal(jw.conn)
+					}
+					w = nil
+				}
+			}
+			if werr != nil && !failed {
+				logger.Warningf("failed to write log of %s: %v", appId, werr)
+			}
+			failed = werr != nil
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Warning(err)
+			}
+			return
+		}
+	}
+}
+
+// appOutputCapture 捕获一次启动的输出，launch 通过 FIFO 捕获，runCommand 通过管道捕获
+type appOutputCapture struct {
+	fifo string
+	pw   *os.File
+}
+
+// captureFifo 创建 FIFO 并开始读取，应用通过 getCmdPrefix 返回的命令前缀把输出重定向到 FIFO
+func (lm *appLogManager) captureFifo(appId string) (*appOutputCapture, error) {
+	if lm.mode == appLogModeNone {
+		return nil, nil
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	fifo := filepath.Join(dir, "startdde-app-output-"+genUuid())
+	err := syscall.Mkfifo(fifo, 0600)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		// 阻塞直到应用打开写端
+		f, err := os.OpenFile(fifo, os.O_RDONLY, 0)
+		_ = os.Remove(fifo)
+		if err != nil {
+			logger.Warning(err)
+			return
+		}
+		lm.consume(appId, f)
+	}()
+	return &appOutputCapture{fifo: fifo}, nil
+}
+
+// capturePipe 把 cmd 没有重定向的输出接到管道上，需要在 cmd 启动后调用 closeWriter
+func (lm *appLogManager) capturePipe(appId string, cmd *exec.Cmd) (*appOutputCapture, error) {
+	if lm.mode == appLogModeNone || (cmd.Stdout != nil && cmd.Stderr != nil) {
+		return nil, nil
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = pw
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = pw
+	}
+	go lm.consume(appId, pr)
+	return &appOutputCapture{pw: pw}, nil
+}
+
+func (c *appOutputCapture) getCmdPrefix() []string {
+	if c == nil || c.fifo == "" {
+		return nil
+	}
+	return []string{"/bin/sh", "-c", `exec "$@" >>` + shellQuote(c.fifo) + " 2>&1", "sh"}
+}
+
+// closeWriter 关闭 startdde 持有的写端，进程启动后调用
+func (c *appOutputCapture) closeWriter() {
+	if c != nil && c.pw != nil {
+		c.pw.Close()
+		c.pw = nil
+	}
+}
+
+// release 在应用没有打开 FIFO 就退出或启动失败时结束读取
+func (c *appOutputCapture) release() {
+	if c == nil {
+		return
+	}
+	c.closeWriter()
+	if c.fifo == "" {
+		return
+	}
+	// 打开再关闭写端使读端结束等待，FIFO 存在时读端一定会打开，所以不会一直阻塞；
+	// 读端打开后 FIFO 已经被删除，打开失败不需要处理
+	f, err := os.OpenFile(c.fifo, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+	}
+}
+
+// tail 返回应用最后 n 行输出
+func (lm *appLogManager) tail(appId string, n int) ([]string, error) {
+	if n <= 0 || n > appLogMaxTailLines {
+		n = appLogMaxTailLines
+	}
+	switch lm.mode {
+	case appLogModeJournal:
+		out, err := exec.Command("journalctl", "--user", "-o", "cat", "-n", strconv.Itoa(n),
+			"APP_ID="+getAppLogId(appId)).Output()
+		if err != nil {
+			return nil, err
+		}
+		out = bytes.TrimSuffix(out, []byte("\n"))
+		if len(out) == 0 {
+			return []string{}, nil
+		}
+		return strings.Split(string(out), "\n"), nil
+	case appLogModeNone:
+		return nil, errors.New("app log capture is disabled")
+	}
+	return lm.getLog(appId).tail(n)
+}
+
+// GetAppLog 返回应用最后 lines 行标准输出和标准错误，appId 为 desktop 文件的 id 或命令的文件名
+func (m *StartManager) GetAppLog(sender dbus.Sender, appId string, lines int32) ([]string, *dbus.Error) {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return nil, dbusutil.ToError(err)
+	}
+	if appId == "" {
+		return nil, dbusutil.ToError(errors.New("empty app id"))
+	}
+	ret, err := m.appLog.tail(appId, int(lines))
+	if err != nil {
+		return nil, dbusutil.ToError(err)
+	}
+	if ret == nil {
+		ret = []string{}
+	}
+	return ret, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rotatingLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-app-log")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l := newRotatingLog(filepath.Join(dir, "apps", "a.log"), 20, 2)
+	for i := 0; i < 10; i++ {
+		_, err = fmt.Fprintf(l, "line %d\n", i)
+		assert.Nil(t, err)
+	}
+
+	// 每个文件最多两行，只保留 a.log、a.log.1 和 a.log.2
+	_, err = os.Stat(filepath.Join(dir, "apps", "a.log.2"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "apps", "a.log.3"))
+	assert.True(t, os.IsNotExist(err))
+
+	lines, err := l.tail(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"line 7", "line 8", "line 9"}, lines)
+
+	lines, err = l.tail(100)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"line 4", "line 5", "line 6", "line 7", "line 8", "line 9"}, lines)
+
+	lines, err = newRotatingLog(filepath.Join(dir, "notexist.log"), 20, 2).tail(10)
+	assert.Nil(t, err)
+	assert.Empty(t, lines)
+}
+
+func waitForLines(lm *appLogManager, appId string, n int) []string {
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines, _ = lm.tail(appId, 100)
+		if len(lines) >= n {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return lines
+}
+
+func Test_appLogManager_capture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-app-log")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	lm := newAppLogManager("", filepath.Join(dir, "apps"))
+	assert.Equal(t, appLogModeFile, lm.mode)
+
+	// RunCommand 使用管道
+	cmd := exec.Command("/bin/sh", "-c", "echo out; echo err >&2; printf 'no newline'")
+	c, err := lm.capturePipe("sh", cmd)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, cmd.Start())
+	c.closeWriter()
+	assert.Nil(t, cmd.Wait())
+	assert.ElementsMatch(t, []string{"out", "err", "no newline"}, waitForLines(lm, "sh", 3))
+
+	// launch 使用 FIFO 和命令前缀
+	c, err = lm.captureFifo("kde/app")
+	if !assert.Nil(t, err) {
+		return
+	}
+	args := append(c.getCmdPrefix(), "/bin/sh", "-c", "echo fifo")
+	cmd = exec.Command(args[0], args[1:]...)
+	assert.Nil(t, cmd.Start())
+	assert.Nil(t, cmd.Wait())
+	c.release()
+	assert.Equal(t, []string{"fifo"}, waitForLines(lm, "kde-app", 1))
+	fileInfo, err := os.Stat(filepath.Join(dir, "apps", "kde-app.log"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0600), fileInfo.Mode().Perm())
+	}
+	fileInfo, err = os.Stat(filepath.Join(dir, "apps"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0700), fileInfo.Mode().Perm())
+	}
+
+	// 启动失败时 release 结束读取并删除 FIFO
+	c, err = lm.captureFifo("failed")
+	if !assert.Nil(t, err) {
+		return
+	}
+	c.release()
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(c.fifo); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_appLogManager_consumeLongLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-app-log")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	lm := newAppLogManager(appLogModeFile, dir)
+
+	output := strings.Repeat("a", appLogMaxLineLen+10) + "\nend\n"
+	lm.consume("long", ioutil.NopCloser(strings.NewReader(output)))
+	lines, err := lm.tail("long", 10)
+	assert.Nil(t, err)
+	if assert.Len(t, lines, 3) {
+		assert.Len(t, lines[0], appLogMaxLineLen)
+		assert.Equal(t, strings.Repeat("a", 10), lines[1])
+		assert.Equal(t, "end", lines[2])
+	}
+}
+
+func Test_appLogManager_none(t *testing.T) {
+	lm := newAppLogManager(appLogModeNone, "")
+	c, err := lm.captureFifo("a")
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+	assert.Nil(t, c.getCmdPrefix())
+	c.release()
+
+	_, err = lm.tail("a", 10)
+	assert.NotNil(t, err)
+}
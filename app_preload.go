@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+// 应用启动后记录它映射的文件，以后启动应用或登录时提前读入页缓存，减少机械硬盘上的启动时间
+const (
+	// 启动后等待此时间再读取 /proc/<pid>/maps
+	preloadRecordDelay = 5 * time.Second
+	preloadMaxFiles    = 1000
+	// 大于此值的文件只读入开头部分
+	preloadMaxFileSize = 64 * 1024 * 1024
+
+	// 登录时预读的应用数量
+	preloadLoginApps = 10
+	// 启动次数的权重每过 preloadHalfLife 减半
+	preloadHalfLife = 7 * 24 * time.Hour
+
+	// IO 压力(/proc/pressure/io 的 some avg10)超过此值时暂停预读
+	preloadMaxIOPressure = 20.0
+	preloadPressureWait  = 500 * time.Millisecond
+	// 没有 PSI 时限制每秒预读的字节数
+	preloadMaxBytesPerSec = 8 * 1024 * 1024
+
+	procPressureIO = "/proc/pressure/io"
+)
+
+type preloadAppInfo struct {
+	Files      []string
+	Launches   int
+	LastLaunch int64 // unix time in milliseconds
+}
+
+type preloadData struct {
+	Enabled bool
+	Apps    map[string]*preloadAppInfo
+}
+
+// PreloadStats 由 GetPreloadStats 返回
+type PreloadStats struct {
+	Enabled        bool
+	Apps           int
+	Files          int
+	PreloadedApps  int
+	PreloadedFiles int
+	PreloadedBytes int64
+	// 登录时预读花费的时间，单位为毫秒
+	LoginPreloadTime int64
+}
+
+type preloadManager struct {
+	mu    sync.Mutex
+	file  string
+	data  preloadData
+	stats PreloadStats
+
+	pressureFile string
+}
+
+func getPreloadFile() string {
+	return filepath.Join(basedir.GetUserCacheDir(), "deepin", "startdde", "preload.json")
+}
+
+func newPreloadManager(file string) *preloadManager {
+	pm := &preloadManager{
+		file:         file,
+		pressureFile: procPressureIO,
+	}
+	pm.data.Enabled = true
+	content, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(content, &pm.data)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load preload data:", err)
+	}
+	if pm.data.Apps == nil {
+		pm.data.Apps = make(map[string]*preloadAppInfo)
+	}
+	return pm
+}
+
+// save 需要在持有 pm.mu 的情况下调用
+func (pm *preloadManager) save() error {
+	content, err := json.Marshal(pm.data)
+	if err != nil {
+		return err
+	}
+	// 记录中有用户使用过的应用和文件，只有用户自己可以读取
+	err = os.MkdirAll(filepath.Dir(pm.file), 0700)
+	if err != nil {
+		return err
+	}
+	// 以前创建的文件权限可能是 0644
+	err = os.Chmod(pm.file, 0600)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning(err)
+	}
+	return ioutil.WriteFile(pm.file, content, 0600)
+}
+
+func (pm *preloadManager) isEnabled() bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.data.Enabled
+}
+
+func (pm *preloadManager) setEnabled(enabled bool) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.data.Enabled = enabled
+	return pm.save()
+}
+
+// getMappedFiles 返回 maps 文件中映射的普通文件，已删除的文件不在其中
+func getMappedFiles(mapsFile string) ([]string, error) {
+	f, err := os.Open(mapsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode pathname，路径中可能有空格，取 inode 之后的全部内容
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[4] == "0" {
+			continue
+		}
+		path := line
+		for i := 0; i < 5; i++ {
+			path = strings.TrimLeft(path, " ")
+			path = path[strings.IndexByte(path, ' ')+1:]
+		}
+		path = strings.TrimLeft(path, " ")
+		if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "/dev/") ||
+			strings.HasPrefix(path, "/memfd:") || strings.HasPrefix(path, "/SYSV") ||
+			strings.HasSuffix(path, " (deleted)") {
+			continue
+		}
+		// 同一个文件的多个段是连续的
+		if len(files) > 0 && files[len(files)-1] == path {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, scanner.Err()
+}
+
+// mergeFiles 合并文件列表，保持首次出现的顺序，最多保留 max 个
+func mergeFiles(a, b []string, max int) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var ret []string
+	for _, list := range [][]string{a, b} {
+		for _, file := range list {
+			if seen[file] || len(ret) >= max {
+				continue
+			}
+			seen[file] = true
+			ret = append(ret, file)
+		}
+	}
+	return ret
+}
+
+// record 记录应用进程映射的文件，pids 为应用 cgroup 中的进程
+func (pm *preloadManager) record(appId string, pids []int) {
+	var files []string
+	for _, pid := range pids {
+		exe, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+		if err == nil {
+			files = append(files, exe)
+		}
+		mapped, err := getMappedFiles("/proc/" + strconv.Itoa(pid) + "/maps")
+		if err != nil {
+			logger.Debug(err)
+			continue
+		}
+		files = append(files, mapped...)
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	info := pm.data.Apps[appId]
+	if info == nil {
+		return
+	}
+	info.Files = mergeFiles(files, info.Files, preloadMaxFiles)
+	err := pm.save()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// addLaunch 记录应用启动，返回是否需要记录文件
+func (pm *preloadManager) addLaunch(appId string, now time.Time) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if !pm.data.Enabled {
+		return false
+	}
+	info := pm.data.Apps[appId]
+	if info == nil {
+		info = &preloadAppInfo{}
+		pm.data.Apps[appId] = info
+	}
+	info.Launches++
+	info.LastLaunch = toMilliseconds(now)
+	return true
+}
+
+// getLaunchScore 返回应用被启动的可能性，最近启动的次数权重更高
+func getLaunchScore(info *preloadAppInfo, now time.Time) float64 {
+	age := now.Sub(time.Unix(0, info.LastLaunch*int64(time.Millisecond)))
+	if age < 0 {
+		age = 0
+	}
+	return float64(info.Launches) * math.Pow(0.5, float64(age)/float64(preloadHalfLife))
+}
+
+// getLikelyApps 按启动可能性从高到低返回最多 n 个应用
+func (pm *preloadManager) getLikelyApps(n int, now time.Time) []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	type appScore struct {
+		id    string
+		score float64
+	}
+	var scores []appScore
+	for id, info := range pm.data.Apps {
+		if len(info.Files) > 0 {
+			scores = append(scores, appScore{id, getLaunchScore(info, now)})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score != scores[j].score {
+			return scores[i].score > scores[j].score
+		}
+		return scores[i].id < scores[j].id
+	})
+	var ids []string
+	for i := 0; i < len(scores) && i < n; i++ {
+		ids = append(ids, scores[i].id)
+	}
+	return ids
+}
+
+// getIOPressure 返回最近 10 秒有任务等待 IO 的时间百分比
+func getIOPressure(file string) (float64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				return strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			}
+		}
+	}
+	return 0, errors.New("no some avg10 in " + file)
+}
+
+// throttle 在 IO 压力大时等待，没有 PSI 时按 preloadMaxBytesPerSec 限速，n 是上一次预读的字节数
+func (pm *preloadManager) throttle(n int64) {
+	for i := 0; i < 20; i++ {
+		pressure, err := getIOPressure(pm.pressureFile)
+		if err != nil {
+			time.Sleep(time.Duration(n) * time.Second / preloadMaxBytesPerSec)
+			return
+		}
+		if pressure < preloadMaxIOPressure {
+			return
+		}
+		time.Sleep(preloadPressureWait)
+	}
+}
+
+// readahead 把文件读入页缓存，返回读入的字节数
+func readahead(file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return 0, nil
+	}
+	size := fileInfo.Size()
+	if size > preloadMaxFileSize {
+		size = preloadMaxFileSize
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_READAHEAD, f.Fd(), 0, uintptr(size))
+	if errno != 0 {
+		return 0, errno
+	}
+	return size, nil
+}
+
+func (pm *preloadManager) getFiles(appId string) []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	info := pm.data.Apps[appId]
+	if info == nil {
+		return nil
+	}
+	return append([]string(nil), info.Files...)
+}
+
+// preloadApp 预读应用记录的文件
+func (pm *preloadManager) preloadApp(appId string) {
+	files := pm.getFiles(appId)
+	if len(files) == 0 {
+		return
+	}
+	var count int
+	var bytes, n int64
+	for _, file := range files {
+		if !pm.isEnabled() {
+			break
+		}
+		pm.throttle(n)
+		var err error
+		n, err = readahead(file)
+		if err != nil {
+			continue
+		}
+		count++
+		bytes += n
+	}
+	logger.Debugf("preload %s: %d files, %d bytes", appId, count, bytes)
+
+	pm.mu.Lock()
+	pm.stats.PreloadedApps++
+	pm.stats.PreloadedFiles += count
+	pm.stats.PreloadedBytes += bytes
+	pm.mu.Unlock()
+}
+
+// preloadAtLogin 按启动可能性预读最常用的应用
+func (pm *preloadManager) preloadAtLogin() {
+	if !pm.isEnabled() {
+		return
+	}
+	start := time.Now()
+	for _, appId := range pm.getLikelyApps(preloadLoginApps, start) {
+		pm.preloadApp(appId)
+	}
+	pm.mu.Lock()
+	pm.stats.LoginPreloadTime = int64(time.Since(start) / time.Millisecond)
+	pm.mu.Unlock()
+}
+
+func (pm *preloadManager) getStats() PreloadStats {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	stats := pm.stats
+	stats.Enabled = pm.data.Enabled
+	stats.Apps = len(pm.data.Apps)
+	stats.Files = 0
+	for _, info := range pm.data.Apps {
+		stats.Files += len(info.Files)
+	}
+	return stats
+}
+
+// recordAppFiles 记录应用启动，并在应用启动一段时间后记录它的进程映射的文件
+func (m *StartManager) recordAppFiles(app *launchedApp, pid int) {
+	if !m.preload.addLaunch(app.id, time.Now()) {
+		return
+	}
+	cgroupDir := app.getMemoryCgroup(pid)
+	time.AfterFunc(preloadRecordDelay, func() {
+		pids := []int{pid}
+		if cgroupDir != "" {
+			procs, err := readCgroupProcs(filepath.Join(cgroupDir, "cgroup.procs"))
+			if err == nil && len(procs) > 0 {
+				pids = procs
+			}
+		}
+		m.preload.record(app.id, pids)
+	})
+}
+
+func readCgroupProcs(file string) ([]int, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(field)
+		if err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// SetPreloadEnabled 打开或关闭应用预读
+func (m *StartManager) SetPreloadEnabled(sender dbus.Sender, enabled bool) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.preload.setEnabled(enabled)
+	return dbusutil.ToError(err)
+}
+
+// GetPreloadStats 以 JSON 格式返回预读的统计信息
+func (m *StartManager) GetPreloadStats() (string, *dbus.Error) {
+	data, err := json.Marshal(m.preload.getStats())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMappedFiles(t *testing.T) {
+	files, err := getMappedFiles("testdata/app_preload/maps")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"/usr/bin/deepin-music",
+		"/usr/lib/x86_64-linux-gnu/libc-2.28.so",
+		"/usr/share/icons/hicolor/icon-theme.cache",
+		"/opt/apps/My App/lib/libfoo.so",
+	}, files)
+
+	_, err = getMappedFiles("testdata/app_preload/not-exist")
+	assert.NotNil(t, err)
+}
+
+func TestMergeFiles(t *testing.T) {
+	assert.Equal(t, []string{"/a", "/b", "/c"}, mergeFiles([]string{"/a", "/b"}, []string{"/b", "/c"}, 10))
+	assert.Equal(t, []string{"/a", "/b"}, mergeFiles([]string{"/a", "/b"}, []string{"/c"}, 2))
+	assert.Nil(t, mergeFiles(nil, nil, 10))
+}
+
+func TestGetIOPressure(t *testing.T) {
+	pressure, err := getIOPressure("testdata/app_preload/pressure-low")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, pressure)
+
+	pressure, err = getIOPressure("testdata/app_preload/pressure-high")
+	assert.Nil(t, err)
+	assert.Equal(t, 45.0, pressure)
+
+	_, err = getIOPressure("testdata/app_preload/pressure-invalid")
+	assert.NotNil(t, err)
+	_, err = getIOPressure("testdata/app_preload/not-exist")
+	assert.NotNil(t, err)
+}
+
+func TestPreloadManagerThrottle(t *testing.T) {
+	pm := &preloadManager{pressureFile: "testdata/app_preload/not-exist"}
+	// 没有 PSI 时按字节数限速
+	start := time.Now()
+	pm.throttle(preloadMaxBytesPerSec / 20)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	pm.pressureFile = "testdata/app_preload/pressure-low"
+	start = time.Now()
+	pm.throttle(preloadMaxBytesPerSec)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestGetLaunchScore(t *testing.T) {
+	now := time.Now()
+	info := &preloadAppInfo{Launches: 8, LastLaunch: toMilliseconds(now)}
+	assert.InDelta(t, 8.0, getLaunchScore(info, now), 0.001)
+	assert.InDelta(t, 4.0, getLaunchScore(info, now.Add(preloadHalfLife)), 0.001)
+	assert.InDelta(t, 2.0, getLaunchScore(info, now.Add(2*preloadHalfLife)), 0.001)
+}
+
+func TestPreloadManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-preload")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "preload.json")
+	pm := newPreloadManager(file)
+	pm.pressureFile = "testdata/app_preload/pressure-low"
+	assert.True(t, pm.isEnabled())
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.True(t, pm.addLaunch("deepin-music", now.Add(-30*24*time.Hour)))
+	}
+	assert.True(t, pm.addLaunch("deepin-editor", now))
+	assert.True(t, pm.addLaunch("deepin-draw", now))
+
+	pm.record("deepin-music", []int{os.Getpid()})
+	pm.record("deepin-editor", []int{os.Getpid()})
+	// 没有启动记录的应用不记录文件
+	pm.record("dde-file-manager", []int{os.Getpid()})
+	assert.NotEmpty(t, pm.getFiles("deepin-music"))
+	assert.Empty(t, pm.getFiles("dde-file-manager"))
+
+	// 最近启动的应用优先，没有文件的应用不预读
+	assert.Equal(t, []string{"deepin-editor", "deepin-music"}, pm.getLikelyApps(10, now))
+	assert.Equal(t, []string{"deepin-editor"}, pm.getLikelyApps(1, now))
+
+	pm.preloadApp("deepin-editor")
+	stats := pm.getStats()
+	assert.True(t, stats.Enabled)
+	assert.Equal(t, 3, stats.Apps)
+	assert.Equal(t, 1, stats.PreloadedApps)
+	assert.True(t, stats.PreloadedFiles > 0)
+
+	// 关闭后不再记录
+	assert.Nil(t, pm.setEnabled(false))
+	assert.False(t, pm.addLaunch("deepin-music", now))
+
+	pm1 := newPreloadManager(file)
+	assert.False(t, pm1.isEnabled())
+	assert.Equal(t, 3, pm1.data.Apps["deepin-music"].Launches)
+	assert.Equal(t, pm.getFiles("deepin-music"), pm1.getFiles("deepin-music"))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/keyfile"
+)
+
+// 管理员按 app id 覆盖 desktop 文件中的资源限制，每个应用一个 section，
+// 键名为 desktop 文件中的键去掉 X-Deepin- 前缀，值为 0 表示不限制。
+const appResourcesLimitConfigFile = "/etc/deepin/startdde/app-resources-limit.conf"
+
+const (
+	keyPrefixXDeepin = "X-Deepin-"
+
+	cgroupWeightMin = 1
+	cgroupWeightMax = 10000
+)
+
+type resourcesLimitKey struct {
+	name  string
+	scale uint64 // 配置中的值乘以 scale 为 AppResourcesLimit 中的值
+	field func(limit *swapsched.AppResourcesLimit) *uint64
+	valid func(v uint64) bool
+}
+
+func isValidCgroupWeight(v uint64) bool {
+	return v == 0 || (v >= cgroupWeightMin && v <= cgroupWeightMax)
+}
+
+var resourcesLimitKeys = []resourcesLimitKey{
+	// 单位为 MB
+	{name: "MaximumRAM", scale: 1e6, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.MemHardLimit
+	}},
+	// 单位为 MB/s
+	{name: "BlkioReadMBPS", scale: 1e6, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.BlkioReadBPS
+	}},
+	{name: "BlkioWriteMBPS", scale: 1e6, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.BlkioWriteBPS
+	}},
+	// 单位为百分比，200 表示最多使用两个 CPU
+	{name: "CPUQuota", scale: 1, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.CPUQuota
+	}},
+	{name: "CPUWeight", scale: 1, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.CPUWeight
+	}, valid: isValidCgroupWeight},
+	{name: "MaxTasks", scale: 1, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.MaxTasks
+	}},
+	{name: "IOWeight", scale: 1, field: func(l *swapsched.AppResourcesLimit) *uint64 {
+		return &l.IOWeight
+	}, valid: isValidCgroupWeight},
+}
+
+type uint64Getter interface {
+	GetUint64(section, key string) (uint64, error)
+}
+
+// readResourcesLimit 读取 section 中存在的键，不存在的键保持 limit 中原来的值
+func readResourcesLimit(limit *swapsched.AppResourcesLimit, getter uint64Getter,
+	section, keyPrefix string) {
+	for _, k := range resourcesLimitKeys {
+		v, err := getter.GetUint64(section, keyPrefix+k.name)
+		if err != nil {
+			continue
+		}
+		if k.valid != nil && !k.valid(v) {
+			logger.Warningf("invalid resources limit %s%s=%d in section %s",
+				keyPrefix, k.name, v, section)
+			continue
+		}
+		*k.field(limit) = v * k.scale
+	}
+}
+
+func loadAppResourcesLimitConfig(filename string) *keyfile.KeyFile {
+	_, err := os.Stat(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return nil
+	}
+
+	kf := keyfile.NewKeyFile()
+	err = kf.LoadFromFile(filename)
+	if err != nil {
+		logger.Warningf("failed to load %s: %v", filename, err)
+		return nil
+	}
+	return kf
+}
+
+// getAppResourcesLimit 返回应用的资源限制，config 中该应用的配置优先于 desktop 文件
+func getAppResourcesLimit(appInfo *desktopappinfo.DesktopAppInfo,
+	config *keyfile.KeyFile) *swapsched.AppResourcesLimit {
+	limit := &swapsched.AppResourcesLimit{}
+	readResourcesLimit(limit, appInfo, desktopappinfo.MainSection, keyPrefixXDeepin)
+	if config != nil {
+		readResourcesLimit(limit, config, appInfo.GetId(), "")
+	}
+	return limit
+}
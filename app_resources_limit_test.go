@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+func TestGetAppResourcesLimit(t *testing.T) {
+	appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile("testdata/app_resources_limit/browser.desktop")
+	assert.Nil(t, err)
+
+	limit := getAppResourcesLimit(appInfo, nil)
+	assert.Equal(t, &swapsched.AppResourcesLimit{
+		MemHardLimit: 2000e6,
+		BlkioReadBPS: 50e6,
+		CPUQuota:     200,
+		CPUWeight:    50,
+		MaxTasks:     512,
+	}, limit)
+
+	config := loadAppResourcesLimitConfig("testdata/app_resources_limit/app-resources-limit.conf")
+	assert.NotNil(t, config)
+	limit = getAppResourcesLimit(appInfo, config)
+	// IOWeight 超出范围被忽略
+	assert.Equal(t, &swapsched.AppResourcesLimit{
+		BlkioReadBPS: 50e6,
+		CPUQuota:     150,
+		CPUWeight:    50,
+		MaxTasks:     1024,
+	}, limit)
+
+	assert.Nil(t, loadAppResourcesLimitConfig("testdata/app_resources_limit/not-exist.conf"))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pkg.deepin.io/gir/gio-2.0"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+const (
+	// 应用缩放比例，每项的格式为 appId=scale
+	gKeyAppsScaleFactor = "apps-scale-factor"
+
+	KeyXDeepinElectron = "X-Deepin-Electron"
+
+	envDeepinWineScale = "DEEPIN_WINE_SCALE"
+
+	appScaleFactorMax = 4.0
+)
+
+func parseAppsScaleFactor(list []string) map[string]float64 {
+	result := make(map[string]float64, len(list))
+	for _, item := range list {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		scale, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || !isValidAppScaleFactor(scale) {
+			logger.Warningf("invalid app scale factor %q", item)
+			continue
+		}
+		result[kv[0]] = scale
+	}
+	return result
+}
+
+func formatAppsScaleFactor(factors map[string]float64) []string {
+	list := make([]string, 0, len(factors))
+	for appId, scale := range factors {
+		list = append(list, appId+"="+formatScale(scale))
+	}
+	sort.Strings(list)
+	return list
+}
+
+func isValidAppScaleFactor(scale float64) bool {
+	return scale > 0 && scale <= appScaleFactorMax
+}
+
+// getWindowScale 与 xsettings 计算 window-scale 的方法相同，1.7 < scale < 2 时为 2
+func getWindowScale(scale float64) int {
+	windowScale := int(math.Trunc((scale+0.3)*10) / 10)
+	if windowScale < 1 {
+		windowScale = 1
+	}
+	return windowScale
+}
+
+func formatScale(scale float64) string {
+	return strconv.FormatFloat(scale, 'f', -1, 64)
+}
+
+// getScaleEnv 返回使应用以 appScale 缩放的环境变量，globalScale 是桌面的缩放比例
+//
+// Qt 应用的缩放比例为 QT_SCREEN_SCALE_FACTORS 或 qt-theme.ini 中的 ScreenScaleFactors 乘以 QT_SCALE_FACTOR，
+// GTK 应用的字体缩放为 Gdk/UnscaledDPI/96 * GDK_SCALE * GDK_DPI_SCALE，
+// xsettings 在 window-scale 大于 1 时把 Gdk/UnscaledDPI 设为 96，否则为 96 * globalScale。
+func getScaleEnv(appScale, globalScale float64) []string {
+	if globalScale <= 0 {
+		globalScale = 1
+	}
+	unscaledDPIScale := globalScale
+	if getWindowScale(globalScale) > 1 {
+		unscaledDPIScale = 1
+	}
+	gdkScale := getWindowScale(appScale)
+	gdkDPIScale := appScale / (unscaledDPIScale * float64(gdkScale))
+
+	return []string{
+		"QT_SCREEN_SCALE_FACTORS=" + formatScale(globalScale),
+		"QT_SCALE_FACTOR=" + formatScale(appScale/globalScale),
+		"GDK_SCALE=" + strconv.Itoa(gdkScale),
+		"GDK_DPI_SCALE=" + formatScale(gdkDPIScale),
+		envDeepinWineScale + "=" + fmt.Sprintf("%.2f", appScale),
+	}
+}
+
+// getDisableScalingEnv 返回禁用缩放列表中的应用使用的环境变量，使应用不缩放
+func getDisableScalingEnv(globalScale float64) []string {
+	qtScale := 1.0
+	if globalScale > 0 {
+		qtScale = 1 / globalScale
+	}
+	return []string{"GDK_DPI_SCALE=1", "GDK_SCALE=1", "QT_SCALE_FACTOR=" + formatScale(qtScale)}
+}
+
+// isElectronApp 判断是否为 Electron 应用，desktop 文件可以用 X-Deepin-Electron 声明，
+// 否则检查可执行文件所在目录下是否有 Electron 的资源包
+func isElectronApp(appInfo *desktopappinfo.DesktopAppInfo) bool {
+	v, err := appInfo.GetBool(desktopappinfo.MainSection, KeyXDeepinElectron)
+	if err == nil {
+		return v
+	}
+
+	exe, err := exec.LookPath(appInfo.GetExecutable())
+	if err != nil {
+		return false
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return false
+	}
+	dir := filepath.Dir(exe)
+	for _, name := range []string{"app.asar", "electron.asar"} {
+		if _, err := os.Stat(filepath.Join(dir, "resources", name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func getGlobalScaleFactor() float64 {
+	gs := gio.NewSettings("com.deepin.xsettings")
+	defer gs.Unref()
+	return gs.GetDouble("scale-factor")
+}
+
+// getAppScaleFactor 返回应用单独设置的缩放比例，不包括禁用缩放列表中的应用
+func (m *StartManager) getAppScaleFactor(appId string) (float64, bool) {
+	m.mu.Lock()
+	scale, ok := m.appsScaleFactor[appId]
+	m.mu.Unlock()
+	return scale, ok
+}
+
+// setAppScaleFactor 设置应用的缩放比例并保存到 GSettings，scale 为 0 表示取消
+func (m *StartManager) setAppScaleFactor(appId string, scale float64) error {
+	if appId == "" {
+		return fmt.Errorf("app id is empty")
+	}
+	if scale != 0 && !isValidAppScaleFactor(scale) {
+		return fmt.Errorf("invalid scale factor %v", scale)
+	}
+	if !hasGSettingsKey(m.settings, gKeyAppsScaleFactor) {
+		return fmt.Errorf("gsettings key %s not found", gKeyAppsScaleFactor)
+	}
+
+	m.mu.Lock()
+	factors := make(map[string]float64, len(m.appsScaleFactor)+1)
+	for k, v := range m.appsScaleFactor {
+		factors[k] = v
+	}
+	m.mu.Unlock()
+
+	if scale == 0 {
+		delete(factors, appId)
+	} else {
+		factors[appId] = scale
+	}
+	if !m.settings.SetStrv(gKeyAppsScaleFactor, formatAppsScaleFactor(factors)) {
+		return fmt.Errorf("failed to set gsettings key %s", gKeyAppsScaleFactor)
+	}
+	m.mu.Lock()
+	m.appsScaleFactor = factors
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *StartManager) getAppsScaleFactor() map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	factors := make(map[string]float64, len(m.appsScaleFactor))
+	for k, v := range m.appsScaleFactor {
+		factors[k] = v
+	}
+	return factors
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAppsScaleFactor(t *testing.T) {
+	factors := parseAppsScaleFactor([]string{"deepin-wine-qq=1.5", "bad", "foo=abc", "bar=10", "wps=1"})
+	assert.Equal(t, map[string]float64{"deepin-wine-qq": 1.5, "wps": 1}, factors)
+	assert.Equal(t, []string{"deepin-wine-qq=1.5", "wps=1"}, formatAppsScaleFactor(factors))
+}
+
+func TestGetWindowScale(t *testing.T) {
+	assert.Equal(t, 1, getWindowScale(1))
+	assert.Equal(t, 1, getWindowScale(1.5))
+	assert.Equal(t, 2, getWindowScale(1.75))
+	assert.Equal(t, 2, getWindowScale(2))
+	assert.Equal(t, 1, getWindowScale(0.5))
+}
+
+func TestGetScaleEnv(t *testing.T) {
+	assert.Equal(t, []string{
+		"QT_SCREEN_SCALE_FACTORS=2",
+		"QT_SCALE_FACTOR=0.5",
+		"GDK_SCALE=1",
+		"GDK_DPI_SCALE=1",
+		"DEEPIN_WINE_SCALE=1.00",
+	}, getScaleEnv(1, 2))
+
+	assert.Equal(t, []string{
+		"QT_SCREEN_SCALE_FACTORS=2",
+		"QT_SCALE_FACTOR=0.75",
+		"GDK_SCALE=1",
+		"GDK_DPI_SCALE=1.5",
+		"DEEPIN_WINE_SCALE=1.50",
+	}, getScaleEnv(1.5, 2))
+
+	assert.Equal(t, []string{
+		"QT_SCREEN_SCALE_FACTORS=1.25",
+		"QT_SCALE_FACTOR=1.6",
+		"GDK_SCALE=2",
+		"GDK_DPI_SCALE=0.8",
+		"DEEPIN_WINE_SCALE=2.00",
+	}, getScaleEnv(2, 1.25))
+}
+
+func TestGetDisableScalingEnv(t *testing.T) {
+	assert.Equal(t, []string{"GDK_DPI_SCALE=1", "GDK_SCALE=1", "QT_SCALE_FACTOR=0.5"},
+		getDisableScalingEnv(2))
+	assert.Equal(t, []string{"GDK_DPI_SCALE=1", "GDK_SCALE=1", "QT_SCALE_FACTOR=0.8"},
+		getDisableScalingEnv(1.25))
+	assert.Equal(t, []string{"GDK_DPI_SCALE=1", "GDK_SCALE=1", "QT_SCALE_FACTOR=1"},
+		getDisableScalingEnv(0))
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	gio "pkg.deepin.io/gir/gio-2.0"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/gsettings"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+// AutostartCondition 支持的条件
+const (
+	autostartConditionGSettings    = "gsettings"     // GSettings <schema> <key>，布尔值为真时自启动
+	autostartConditionIfExists     = "if-exists"     // if-exists <file>，文件存在时自启动
+	autostartConditionUnlessExists = "unless-exists" // unless-exists <file>，文件不存在时自启动
+)
+
+// X-GNOME-Autostart-Phase 的阶段，按启动顺序排列，没有指定阶段的是 Applications
+var autostartPhases = []string{
+	"EarlyInitialization",
+	"PreDisplayServer",
+	"Initialization",
+	"WindowManager",
+	"Panel",
+	"Desktop",
+	"Applications",
+}
+
+const autostartPhaseApplications = "Applications"
+
+func getAutostartPhaseIndex(phase string) int {
+	for i, p := range autostartPhases {
+		if p == phase {
+			return i
+		}
+	}
+	return len(autostartPhases) - 1
+}
+
+// getAutostartPhaseStage 返回阶段对应的 SessionStage。StartManager 在 CoreBegin 时才创建，
+// 所以初始化阶段的应用在 CoreBegin 启动；窗口管理器、面板和桌面阶段的应用在核心组件启动后的 CoreEnd 启动
+func getAutostartPhaseStage(phase string) int32 {
+	switch phase {
+	case "EarlyInitialization", "PreDisplayServer", "Initialization":
+		return SessionStageCoreBegin
+	case "WindowManager", "Panel", "Desktop":
+		return SessionStageCoreEnd
+	}
+	return SessionStageAppsBegin
+}
+
+type autostartCondition struct {
+	kind   string
+	schema string
+	key    string
+	file   string
+}
+
+// parseAutostartCondition 解析 AutostartCondition，文件的相对路径基于 configDir，空值返回 nil
+func parseAutostartCondition(value, configDir string) (*autostartCondition, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	cond := &autostartCondition{kind: strings.ToLower(fields[0])}
+	switch cond.kind {
+	case autostartConditionGSettings:
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid condition %q", value)
+		}
+		cond.schema = fields[1]
+		cond.key = fields[2]
+	case autostartConditionIfExists, autostartConditionUnlessExists:
+		// 文件名中可能有空格
+		file := strings.TrimSpace(strings.TrimSpace(value)[len(fields[0]):])
+		if file == "" {
+			return nil, fmt.Errorf("invalid condition %q", value)
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(configDir, file)
+		}
+		cond.file = file
+	default:
+		return nil, fmt.Errorf("unsupported condition %q", value)
+	}
+	return cond, nil
+}
+
+// eval 返回条件是否满足，GSettings 的 schema 或键不存在时不满足
+func (c *autostartCondition) eval(getBool func(schema, key string) (bool, error)) bool {
+	switch c.kind {
+	case autostartConditionGSettings:
+		value, err := getBool(c.schema, c.key)
+		if err != nil {
+			logger.Debug(err)
+			return false
+		}
+		return value
+	case autostartConditionIfExists:
+		_, err := os.Stat(c.file)
+		return err == nil
+	case autostartConditionUnlessExists:
+		_, err := os.Stat(c.file)
+		return os.IsNotExist(err)
+	}
+	return true
+}
+
+func isGSettingsSchemaInstalled(schema string) bool {
+	source := gio.SettingsSchemaSourceGetDefault()
+	s := source.Lookup(schema, true)
+	if s == nil {
+		return false
+	}
+	s.Unref()
+	return true
+}
+
+func getGSettingsBool(schema, key string) (bool, error) {
+	// schema 不存在时 gio.NewSettings 会直接退出进程
+	if !isGSettingsSchemaInstalled(schema) {
+		return false, fmt.Errorf("gsettings schema %q not installed", schema)
+	}
+	gs := gio.NewSettings(schema)
+	defer gs.Unref()
+	if !hasGSettingsKey(gs, key) {
+		return false, fmt.Errorf("no key %q in gsettings schema %q", key, schema)
+	}
+	// 对不是布尔类型的键调用 GetBoolean 会产生 GLib critical 错误
+	value := gs.GetValue(key)
+	typ := value.GetTypeString()
+	value.Unref()
+	if typ != "b" {
+		return false, fmt.Errorf("key %q in gsettings schema %q has type %q, not boolean", key, schema, typ)
+	}
+	return gs.GetBoolean(key), nil
+}
+
+// getAutostartConditionValue 优先使用 AutostartCondition，兼容 X-GNOME-AutostartCondition
+func getAutostartConditionValue(kf stringGetter) string {
+	value, _ := kf.GetString(desktopappinfo.MainSection, KeyAutostartCondition)
+	if value == "" {
+		value, _ = kf.GetString(desktopappinfo.MainSection, KeyXGnomeAutostartCondition)
+	}
+	return value
+}
+
+// checkAutostartCondition 返回 desktop 文件的 AutostartCondition 是否满足，不支持的条件视为满足
+func checkAutostartCondition(kf stringGetter) bool {
+	cond, err := parseAutostartCondition(getAutostartConditionValue(kf), basedir.GetUserConfigDir())
+	if err != nil {
+		logger.Debug(err)
+		return true
+	}
+	if cond == nil {
+		return true
+	}
+	return cond.eval(getGSettingsBool)
+}
+
+// isTryExecAvailable 返回 TryExec 指定的程序是否存在并且可以执行
+func isTryExecAvailable(tryExec string) bool {
+	if tryExec == "" {
+		return true
+	}
+	if !filepath.IsAbs(tryExec) {
+		_, err := exec.LookPath(tryExec)
+		return err == nil
+	}
+	fileInfo, err := os.Stat(tryExec)
+	if err != nil {
+		return false
+	}
+	return fileInfo.Mode().IsRegular() && fileInfo.Mode()&0111 != 0
+}
+
+// autostartConditionMonitor 监听 AutostartCondition 引用的 GSettings 键和文件，
+// 变化后重新判断应用是否自启动
+type autostartConditionMonitor struct {
+	mu         sync.Mutex
+	conditions map[string]*autostartCondition // key 是 desktop 文件
+	enabled    map[string]bool
+	schemas    map[string]bool
+	watcher    *fsnotify.Watcher
+
+	isAutostart func(desktopFile string) bool
+	onChange    func(desktopFile string, enabled bool)
+}
+
+func newAutostartConditionMonitor(isAutostart func(desktopFile string) bool,
+	onChange func(desktopFile string, enabled bool)) *autostartConditionMonitor {
+	return &autostartConditionMonitor{
+		conditions:  make(map[string]*autostartCondition),
+		enabled:     make(map[string]bool),
+		schemas:     make(map[string]bool),
+		isAutostart: isAutostart,
+		onChange:    onChange,
+	}
+}
+
+// setConditions 替换条件，记录新加入的应用当前是否自启动
+func (cm *autostartConditionMonitor) setConditions(conditions map[string]*autostartCondition) {
+	var added []string
+	cm.mu.Lock()
+	for file := range cm.enabled {
+		if conditions[file] == nil {
+			delete(cm.enabled, file)
+		}
+	}
+	for file := range conditions {
+		if _, ok := cm.enabled[file]; !ok {
+			added = append(added, file)
+		}
+	}
+	cm.conditions = conditions
+	cm.mu.Unlock()
+
+	for _, file := range added {
+		enabled := cm.isAutostart(file)
+		cm.mu.Lock()
+		cm.enabled[file] = enabled
+		cm.mu.Unlock()
+	}
+}
+
+// update 替换条件并开始监听新引用的 GSettings schema 和文件所在的目录，
+// 目录不存在时无法监听，只有在 desktop 文件变化时才会重新判断
+func (cm *autostartConditionMonitor) update(conditions map[string]*autostartCondition) {
+	cm.setConditions(conditions)
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, cond := range conditions {
+		switch cond.kind {
+		case autostartConditionGSettings:
+			if cm.schemas[cond.schema] || !isGSettingsSchemaInstalled(cond.schema) {
+				continue
+			}
+			cm.schemas[cond.schema] = true
+			schema := cond.schema
+			gsettings.ConnectChanged(schema, "*", func(key string) {
+				cm.handleGSettingsChanged(schema, key)
+			})
+		case autostartConditionIfExists, autostartConditionUnlessExists:
+			err := cm.watchFile(cond.file)
+			if err != nil {
+				logger.Debugf("failed to watch %s: %v", cond.file, err)
+			}
+		}
+	}
+}
+
+// watchFile 需要在持有 cm.mu 的情况下调用
+func (cm *autostartConditionMonitor) watchFile(file string) error {
+	if cm.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		cm.watcher = watcher
+		go func() {
+			for {
+				select {
+				case ev, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+					cm.handleFileChanged(filepath.Clean(ev.Name))
+				case err, ok := <-watcher.Errors:
+					if !ok {
+						return
+					}
+					logger.Warning("fsnotify error:", err)
+				}
+			}
+		}()
+	}
+	return cm.watcher.Add(filepath.Dir(file))
+}
+
+func (cm *autostartConditionMonitor) handleGSettingsChanged(schema, key string) {
+	cm.check(func(cond *autostartCondition) bool {
+		return cond.kind == autostartConditionGSettings && cond.schema == schema && cond.key == key
+	})
+}
+
+func (cm *autostartConditionMonitor) handleFileChanged(file string) {
+	cm.check(func(cond *autostartCondition) bool {
+		return cond.file == file
+	})
+}
+
+// check 重新判断条件匹配的应用，自启动状态改变时调用 onChange
+func (cm *autostartConditionMonitor) check(match func(cond *autostartCondition) bool) {
+	var files []string
+	cm.mu.Lock()
+	for file, cond := range cm.conditions {
+		if match(cond) {
+			files = append(files, file)
+		}
+	}
+	cm.mu.Unlock()
+	sort.Strings(files)
+
+	for _, file := range files {
+		enabled := cm.isAutostart(file)
+		cm.mu.Lock()
+		changed := cm.enabled[file] != enabled
+		cm.enabled[file] = enabled
+		cm.mu.Unlock()
+		if changed {
+			logger.Debugf("autostart condition of %s changed, enabled: %v", file, enabled)
+			cm.onChange(file, enabled)
+		}
+	}
+}
+
+// getAutostartConditionMap 返回所有带有 AutostartCondition 的自启动文件的条件
+func (m *StartManager) getAutostartConditionMap() map[string]*autostartCondition {
+	conditions := make(map[string]*autostartCondition)
+	dirs := m.autostartDirs()
+	for _, f := range getAutostartFiles(dirs[0], dirs[1:]) {
+		appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile(f.file)
+		if err != nil {
+			continue
+		}
+		cond, err := parseAutostartCondition(getAutostartConditionValue(appInfo), basedir.GetUserConfigDir())
+		if err != nil {
+			logger.Debug(err)
+			continue
+		}
+		if cond != nil {
+			conditions[f.file] = cond
+		}
+	}
+	return conditions
+}
+
+func getAutostartPhase(desktopFile string) string {
+	appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile(desktopFile)
+	if err != nil {
+		return autostartPhaseApplications
+	}
+	phase, _ := appInfo.GetString(desktopappinfo.MainSection, KeyXGnomeAutostartPhase)
+	return phase
+}
+
+// startAutostartStage 按阶段顺序启动 X-GNOME-Autostart-Phase 对应 stage 的自启动应用
+func (m *StartManager) startAutostartStage(stage int32) {
+	m.autostartInitOnce.Do(func() {
+		if _gSettingsConfig != nil {
+			m.autostartQueue.setConcurrency(int(_gSettingsConfig.autostartConcurrency))
+		}
+		m.startupNotifier.addWindowHandler(m.autostartQueue.handleNewWindow)
+		m.autostartConditions.update(m.getAutostartConditionMap())
+	})
+
+	m.mu.Lock()
+	if stage > m.autostartStage {
+		m.autostartStage = stage
+	}
+	m.mu.Unlock()
+
+	autostartList, _ := m.AutostartList()
+	var files []string
+	phaseIndexes := make(map[string]int)
+	for _, desktopFile := range autostartList {
+		phase := getAutostartPhase(desktopFile)
+		if getAutostartPhaseStage(phase) == stage {
+			files = append(files, desktopFile)
+			phaseIndexes[desktopFile] = getAutostartPhaseIndex(phase)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return phaseIndexes[files[i]] < phaseIndexes[files[j]]
+	})
+	logger.Debugf("autostart stage %s: %v", sessionStageNames[stage], files)
+	for _, desktopFile := range files {
+		m.autostartQueue.add(newAutostartItem(desktopFile))
+	}
+}
+
+// handleAutostartConditionChanged 条件满足时启动已经到达阶段的应用，不再满足时结束自启动的进程，
+// 用户自己启动的进程不会被结束
+func (m *StartManager) handleAutostartConditionChanged(desktopFile string, enabled bool) {
+	m.emitSignalAutostartChanged(desktopFile)
+
+	if !enabled {
+		for _, pid := range m.getAutostartPids(desktopFile) {
+			logger.Infof("autostart condition of %s not satisfied, stop pid %d", desktopFile, pid)
+			err := syscall.Kill(pid, syscall.SIGTERM)
+			if err != nil && err != syscall.ESRCH {
+				logger.Warning(err)
+			}
+		}
+		return
+	}
+
+	m.mu.Lock()
+	reached := m.autostartStage >= getAutostartPhaseStage(getAutostartPhase(desktopFile))
+	m.mu.Unlock()
+	if reached && len(m.getRunningPids(desktopFile)) == 0 {
+		m.autostartQueue.add(newAutostartItem(desktopFile))
+	}
+}
+
+// handleAutostartFileChanged 处理自启动目录中文件的变化
+func (m *StartManager) handleAutostartFileChanged(name string) {
+	m.emitSignalAutostartChanged(name)
+	m.autostartConditions.update(m.getAutostartConditionMap())
+}
+
+// getAutostartPids 返回由自启动队列启动并且还在运行的进程
+func (m *StartManager) getAutostartPids(desktopFile string) []int {
+	running := m.getRunningPids(desktopFile)
+	var pids []int
+	for _, pid := range m.autostartQueue.getLaunchedPids(desktopFile) {
+		for _, runningPid := range running {
+			if pid == runningPid {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return pids
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pkg.deepin.io/lib/keyfile"
+)
+
+func TestParseAutostartCondition(t *testing.T) {
+	cond, err := parseAutostartCondition("GSettings org.example.bar autostart", "/home/user/.config")
+	assert.Nil(t, err)
+	assert.Equal(t, &autostartCondition{kind: autostartConditionGSettings, schema: "org.example.bar",
+		key: "autostart"}, cond)
+
+	cond, err = parseAutostartCondition("if-exists foo/bar baz.conf", "/home/user/.config")
+	assert.Nil(t, err)
+	assert.Equal(t, &autostartCondition{kind: autostartConditionIfExists,
+		file: "/home/user/.config/foo/bar baz.conf"}, cond)
+
+	cond, err = parseAutostartCondition("  unless-exists /etc/foo.conf", "/home/user/.config")
+	assert.Nil(t, err)
+	assert.Equal(t, &autostartCondition{kind: autostartConditionUnlessExists, file: "/etc/foo.conf"}, cond)
+
+	cond, err = parseAutostartCondition("", "/home/user/.config")
+	assert.Nil(t, err)
+	assert.Nil(t, cond)
+
+	for _, value := range []string{"GSettings org.example.bar", "if-exists", "GNOME3 if-session gnome"} {
+		_, err = parseAutostartCondition(value, "/home/user/.config")
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestAutostartConditionEval(t *testing.T) {
+	values := map[string]bool{"org.example.bar/on": true, "org.example.bar/off": false}
+	getBool := func(schema, key string) (bool, error) {
+		value, ok := values[schema+"/"+key]
+		if !ok {
+			return false, errors.New("not found")
+		}
+		return value, nil
+	}
+	assert.True(t, (&autostartCondition{kind: autostartConditionGSettings, schema: "org.example.bar",
+		key: "on"}).eval(getBool))
+	assert.False(t, (&autostartCondition{kind: autostartConditionGSettings, schema: "org.example.bar",
+		key: "off"}).eval(getBool))
+	// 键不存在时不满足
+	assert.False(t, (&autostartCondition{kind: autostartConditionGSettings, schema: "org.example.none",
+		key: "on"}).eval(getBool))
+
+	file := "testdata/autostart/system1/bar.desktop"
+	assert.True(t, (&autostartCondition{kind: autostartConditionIfExists, file: file}).eval(getBool))
+	assert.False(t, (&autostartCondition{kind: autostartConditionUnlessExists, file: file}).eval(getBool))
+	assert.False(t, (&autostartCondition{kind: autostartConditionIfExists, file: file + ".none"}).eval(getBool))
+	assert.True(t, (&autostartCondition{kind: autostartConditionUnlessExists, file: file + ".none"}).eval(getBool))
+}
+
+func TestGetAutostartConditionValue(t *testing.T) {
+	kf := keyfile.NewKeyFile()
+	assert.Nil(t, kf.LoadFromFile("testdata/autostart/system1/bar.desktop"))
+	assert.Equal(t, "GSettings org.example.bar autostart", getAutostartConditionValue(kf))
+
+	kf = keyfile.NewKeyFile()
+	assert.Nil(t, kf.LoadFromFile("testdata/autostart/condition.desktop"))
+	assert.Equal(t, "unless-exists foo.conf", getAutostartConditionValue(kf))
+}
+
+func TestIsTryExecAvailable(t *testing.T) {
+	assert.True(t, isTryExecAvailable(""))
+	assert.True(t, isTryExecAvailable("sh"))
+	assert.True(t, isTryExecAvailable("/bin/sh"))
+	assert.False(t, isTryExecAvailable("startdde-no-such-program"))
+	assert.False(t, isTryExecAvailable("/bin/startdde-no-such-program"))
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	// 不可执行的文件
+	assert.False(t, isTryExecAvailable(filepath.Join(wd, "testdata/autostart/condition.desktop")))
+}
+
+func TestGetAutostartPhaseStage(t *testing.T) {
+	assert.Equal(t, SessionStageCoreBegin, getAutostartPhaseStage("Initialization"))
+	assert.Equal(t, SessionStageCoreEnd, getAutostartPhaseStage("Panel"))
+	assert.Equal(t, SessionStageAppsBegin, getAutostartPhaseStage("Applications"))
+	assert.Equal(t, SessionStageAppsBegin, getAutostartPhaseStage(""))
+
+	assert.True(t, getAutostartPhaseIndex("EarlyInitialization") < getAutostartPhaseIndex("Initialization"))
+	assert.True(t, getAutostartPhaseIndex("WindowManager") < getAutostartPhaseIndex("Desktop"))
+	assert.Equal(t, getAutostartPhaseIndex("Applications"), getAutostartPhaseIndex("Unknown"))
+}
+
+func TestAutostartConditionMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-autostart-condition")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	flagFile := filepath.Join(dir, "flag")
+	isAutostart := func(desktopFile string) bool {
+		_, err := os.Stat(flagFile)
+		return err == nil
+	}
+	var changes []string
+	cm := newAutostartConditionMonitor(isAutostart, func(desktopFile string, enabled bool) {
+		if enabled {
+			changes = append(changes, "+"+desktopFile)
+		} else {
+			changes = append(changes, "-"+desktopFile)
+		}
+	})
+	cm.setConditions(map[string]*autostartCondition{
+		"a.desktop": {kind: autostartConditionIfExists, file: flagFile},
+		"b.desktop": {kind: autostartConditionGSettings, schema: "org.example.bar", key: "autostart"},
+	})
+
+	// 不相关的变化
+	cm.handleFileChanged(filepath.Join(dir, "other"))
+	assert.Nil(t, changes)
+
+	assert.Nil(t, ioutil.WriteFile(flagFile, nil, 0644))
+	cm.handleFileChanged(flagFile)
+	assert.Equal(t, []string{"+a.desktop"}, changes)
+	// 状态没有改变
+	cm.handleFileChanged(flagFile)
+	assert.Equal(t, []string{"+a.desktop"}, changes)
+
+	cm.handleGSettingsChanged("org.example.bar", "other")
+	assert.Equal(t, []string{"+a.desktop"}, changes)
+	cm.handleGSettingsChanged("org.example.bar", "autostart")
+	assert.Equal(t, []string{"+a.desktop", "+b.desktop"}, changes)
+
+	// 删除的条件不再检查，新加入的记录当前状态
+	assert.Nil(t, os.Remove(flagFile))
+	cm.setConditions(map[string]*autostartCondition{
+		"a.desktop": {kind: autostartConditionIfExists, file: flagFile},
+		"c.desktop": {kind: autostartConditionUnlessExists, file: flagFile},
+	})
+	changes = nil
+	cm.handleFileChanged(flagFile)
+	sort.Strings(changes)
+	assert.Equal(t, []string{"-a.desktop"}, changes)
+}
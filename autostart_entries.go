@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/keyfile"
+)
+
+const (
+	KeyOnlyShowIn               = "OnlyShowIn"
+	KeyNotShowIn                = "NotShowIn"
+	KeyTryExec                  = "TryExec"
+	KeyAutostartCondition       = "AutostartCondition"
+	KeyXGnomeAutostartCondition = "X-GNOME-AutostartCondition"
+	KeyXGnomeAutostartEnabled   = "X-GNOME-Autostart-enabled"
+	KeyXGnomeAutostartPhase     = "X-GNOME-Autostart-Phase"
+)
+
+const (
+	maxAutostartDelay = 3600
+	// 名称中没有可用于文件名的字符时使用
+	customAutostartDefaultName = "custom"
+)
+
+// 影响应用是否自启动的键
+var autostartConditionKeys = []string{
+	KeyOnlyShowIn,
+	KeyNotShowIn,
+	KeyTryExec,
+	KeyAutostartCondition,
+	KeyXGnomeAutostartCondition,
+	KeyXGnomeAutostartEnabled,
+	KeyXGnomeAutostartPhase,
+}
+
+// AutostartEntry 是 GetAutostartEntries 返回的一个自启动项
+type AutostartEntry struct {
+	Id         string // desktop 文件名
+	File       string // 生效的 desktop 文件
+	Name       string
+	Icon       string
+	Exec       string
+	SourceDir  string
+	SystemFile string `json:",omitempty"`
+	Overridden bool   // 用户目录中的文件覆盖了系统目录中的 SystemFile
+	Custom     bool   // 只存在于用户目录中
+	Enabled    bool
+	Delay      int32             // X-GNOME-Autostart-Delay，单位为秒
+	Conditions map[string]string `json:",omitempty"`
+}
+
+type autostartFile struct {
+	file    string // 生效的文件，用户目录优先
+	sysFile string // 系统目录中优先级最高的同名文件
+}
+
+func listAutostartDir(dir string) []string {
+	fileInfoList, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+		return nil
+	}
+	var names []string
+	for _, fileInfo := range fileInfoList {
+		matched, _ := filepath.Match(`[^#.]*.desktop`, fileInfo.Name())
+		if matched && !fileInfo.IsDir() {
+			names = append(names, fileInfo.Name())
+		}
+	}
+	return names
+}
+
+// getAutostartFiles 按文件名排序返回所有自启动文件，文件名不区分大小写，与 getSysAutostart 一致
+func getAutostartFiles(userDir string, sysDirs []string) []*autostartFile {
+	files := make(map[string]*autostartFile)
+	for _, name := range listAutostartDir(userDir) {
+		files[strings.ToLower(name)] = &autostartFile{file: filepath.Join(userDir, name)}
+	}
+	for _, dir := range sysDirs {
+		for _, name := range listAutostartDir(dir) {
+			key := strings.ToLower(name)
+			f, ok := files[key]
+			if !ok {
+				f = &autostartFile{file: filepath.Join(dir, name)}
+				files[key] = f
+			}
+			if f.sysFile == "" {
+				f.sysFile = filepath.Join(dir, name)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := make([]*autostartFile, len(keys))
+	for i, key := range keys {
+		ret[i] = files[key]
+	}
+	return ret
+}
+
+type stringGetter interface {
+	GetString(section, key string) (string, error)
+}
+
+// getAutostartConditions 返回文件中存在的影响自启动的键和值
+func getAutostartConditions(kf stringGetter) map[string]string {
+	conditions := make(map[string]string)
+	for _, key := range autostartConditionKeys {
+		value, err := kf.GetString(desktopappinfo.MainSection, key)
+		if err == nil && value != "" {
+			conditions[key] = value
+		}
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+	return conditions
+}
+
+// getCustomAutostartName 根据名称生成新的 desktop 文件名，exists 返回文件名是否已被使用
+func getCustomAutostartName(name string, exists func(name string) bool) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	base := strings.Trim(b.String(), "-")
+	if base == "" {
+		base = customAutostartDefaultName
+	}
+	filename := base + ".desktop"
+	for i := 1; exists(filename); i++ {
+		filename = fmt.Sprintf("%s-%d.desktop", base, i)
+	}
+	return filename
+}
+
+func (m *StartManager) getAutostartEntries() []*AutostartEntry {
+	dirs := m.autostartDirs()
+	entries := make([]*AutostartEntry, 0)
+	for _, f := range getAutostartFiles(dirs[0], dirs[1:]) {
+		appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile(f.file)
+		if err != nil {
+			logger.Debug(err)
+			continue
+		}
+		delay, _ := appInfo.GetInt(desktopappinfo.MainSection, KeyXGnomeAutostartDelay)
+		entries = append(entries, &AutostartEntry{
+			Id:         filepath.Base(f.file),
+			File:       f.file,
+			Name:       appInfo.GetName(),
+			Icon:       appInfo.GetIcon(),
+			Exec:       appInfo.GetCommandline(),
+			SourceDir:  filepath.Dir(f.file),
+			SystemFile: f.sysFile,
+			Overridden: f.sysFile != "" && f.file != f.sysFile,
+			Custom:     f.sysFile == "",
+			Enabled:    m.isAutostartAux(f.file),
+			Delay:      int32(delay),
+			Conditions: getAutostartConditions(appInfo),
+		})
+	}
+	return entries
+}
+
+func getAutostartName(id string) (string, error) {
+	name := filepath.Base(id)
+	if !strings.HasSuffix(name, ".desktop") {
+		return "", fmt.Errorf("invalid autostart id %q", id)
+	}
+	return name, nil
+}
+
+// setAutostartDelay 在用户目录的文件中设置延迟，没有用户文件时从系统目录复制
+func (m *StartManager) setAutostartDelay(id string, seconds int32) error {
+	if seconds < 0 || seconds > maxAutostartDelay {
+		return fmt.Errorf("invalid delay %d, should be in [0, %d]", seconds, maxAutostartDelay)
+	}
+	name, err := getAutostartName(id)
+	if err != nil {
+		return err
+	}
+
+	dst := m.getUserAutostart(name)
+	if !Exist(dst) {
+		if m.getSysAutostart(name) == "" {
+			return fmt.Errorf("autostart %q not found", name)
+		}
+		dst, err = m.addAutostartFile(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	keyFile := keyfile.NewKeyFile()
+	err = keyFile.LoadFromFile(dst)
+	if err != nil {
+		return err
+	}
+	keyFile.SetString(desktopappinfo.MainSection, KeyXGnomeAutostartDelay, strconv.Itoa(int(seconds)))
+	logger.Infof("set autostart delay of %s to %ds", name, seconds)
+	return keyFile.SaveToFile(dst)
+}
+
+// resetAutostart 删除用户目录中的文件，系统目录中的同名文件重新生效，用户创建的自启动项被删除
+func (m *StartManager) resetAutostart(id string) error {
+	name, err := getAutostartName(id)
+	if err != nil {
+		return err
+	}
+	if !m.isUserAutostart(name) {
+		return fmt.Errorf("no user autostart file %q", name)
+	}
+	logger.Info("reset autostart", name)
+	return os.Remove(m.getUserAutostart(name))
+}
+
+// createAutostart 在用户目录创建运行 exec 的自启动项，返回文件名
+func (m *StartManager) createAutostart(exec, name string) (string, error) {
+	exec = strings.TrimSpace(exec)
+	name = strings.TrimSpace(name)
+	if exec == "" {
+		return "", errors.New("empty exec")
+	}
+	if strings.ContainsAny(exec+name, "\r\n") {
+		return "", errors.New("exec and name should not contain line breaks")
+	}
+	if name == "" {
+		name = filepath.Base(strings.Fields(exec)[0])
+	}
+
+	filename := getCustomAutostartName(name, func(filename string) bool {
+		return m.isUserAutostart(filename) || m.getSysAutostart(filename) != ""
+	})
+	keyFile := keyfile.NewKeyFile()
+	keyFile.SetString(desktopappinfo.MainSection, "Type", "Application")
+	keyFile.SetString(desktopappinfo.MainSection, "Name", name)
+	keyFile.SetString(desktopappinfo.MainSection, "Exec", exec)
+	err := keyFile.SaveToFile(m.getUserAutostart(filename))
+	if err != nil {
+		return "", err
+	}
+	logger.Infof("create autostart %s: %s", filename, exec)
+	return filename, nil
+}
+
+// GetAutostartEntries 以 JSON 格式返回所有自启动项，包括被禁用的
+func (m *StartManager) GetAutostartEntries() (string, *dbus.Error) {
+	data, err := json.Marshal(m.getAutostartEntries())
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SetAutostartDelay 设置自启动项的 X-GNOME-Autostart-Delay，id 为 desktop 文件名
+func (m *StartManager) SetAutostartDelay(sender dbus.Sender, id string, seconds int32) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.setAutostartDelay(id, seconds)
+	return dbusutil.ToError(err)
+}
+
+// ResetAutostart 删除用户对自启动项的修改
+func (m *StartManager) ResetAutostart(sender dbus.Sender, id string) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.resetAutostart(id)
+	return dbusutil.ToError(err)
+}
+
+// CreateAutostart 创建运行自定义命令的自启动项，返回 desktop 文件名
+func (m *StartManager) CreateAutostart(sender dbus.Sender, exec, name string) (string, *dbus.Error) {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	id, err := m.createAutostart(exec, name)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return id, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pkg.deepin.io/lib/keyfile"
+)
+
+func TestGetAutostartFiles(t *testing.T) {
+	files := getAutostartFiles("testdata/autostart/user",
+		[]string{"testdata/autostart/system1", "testdata/autostart/system2", "testdata/autostart/not-exist"})
+	assert.Equal(t, []*autostartFile{
+		{file: "testdata/autostart/system1/bar.desktop", sysFile: "testdata/autostart/system1/bar.desktop"},
+		{file: "testdata/autostart/system2/baz.desktop", sysFile: "testdata/autostart/system2/baz.desktop"},
+		// 用户文件覆盖系统文件，文件名不区分大小写
+		{file: "testdata/autostart/user/Foo.desktop", sysFile: "testdata/autostart/system1/foo.desktop"},
+		{file: "testdata/autostart/user/my-script.desktop"},
+	}, files)
+}
+
+func TestGetAutostartConditions(t *testing.T) {
+	kf := keyfile.NewKeyFile()
+	assert.Nil(t, kf.LoadFromFile("testdata/autostart/system1/bar.desktop"))
+	assert.Equal(t, map[string]string{
+		KeyTryExec:                  "bar",
+		KeyXGnomeAutostartEnabled:   "false",
+		KeyXGnomeAutostartCondition: "GSettings org.example.bar autostart",
+	}, getAutostartConditions(kf))
+
+	kf = keyfile.NewKeyFile()
+	assert.Nil(t, kf.LoadFromFile("testdata/autostart/system2/baz.desktop"))
+	assert.Nil(t, getAutostartConditions(kf))
+}
+
+func TestGetCustomAutostartName(t *testing.T) {
+	used := map[string]bool{"my-script.desktop": true, "my-script-1.desktop": true}
+	exists := func(name string) bool {
+		return used[name]
+	}
+	assert.Equal(t, "sync-notes.desktop", getCustomAutostartName("Sync Notes", exists))
+	assert.Equal(t, "my-script-2.desktop", getCustomAutostartName("My Script", exists))
+	assert.Equal(t, "custom.desktop", getCustomAutostartName("日记", exists))
+	assert.Equal(t, "a_b.desktop", getCustomAutostartName("../a_b", exists))
+}
+
+func TestGetAutostartName(t *testing.T) {
+	name, err := getAutostartName("/etc/xdg/autostart/foo.desktop")
+	assert.Nil(t, err)
+	assert.Equal(t, "foo.desktop", name)
+
+	_, err = getAutostartName("foo")
+	assert.NotNil(t, err)
+}
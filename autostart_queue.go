@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+const (
+	KeyXDeepinAutostartPriority = "X-Deepin-Autostart-Priority"
+
+	gKeyAutostartConcurrency = "autostart-concurrency"
+
+	defaultAutostartConcurrency = 5
+	// 应用启动后在此时间内没有注册也没有映射窗口，就让出位置给下一个应用
+	autostartSlotTimeout = 10 * time.Second
+
+	envSessionProcessCookieId = "DDE_SESSION_PROCESS_COOKIE_ID"
+)
+
+// 自启动应用的优先级，同一优先级按加入队列的顺序启动
+const (
+	autostartPriorityHigh = iota
+	autostartPriorityNormal
+	autostartPriorityLow
+)
+
+var autostartPriorityNames = []string{"high", "normal", "low"}
+
+func parseAutostartPriority(value string) int {
+	for priority, name := range autostartPriorityNames {
+		if strings.EqualFold(value, name) {
+			return priority
+		}
+	}
+	return autostartPriorityNormal
+}
+
+// 自启动应用在队列中的状态
+const (
+	autostartStateDelayed   = "delayed"
+	autostartStateWaiting   = "waiting"
+	autostartStateLaunching = "launching"
+	autostartStateDone      = "done"
+)
+
+// 自启动应用让出位置的原因
+const (
+	autostartReasonRegistered   = "registered"
+	autostartReasonWindowMapped = "window-mapped"
+	autostartReasonTimeout      = "timeout"
+	autostartReasonFailed       = "failed"
+	autostartReasonExited       = "exited"
+)
+
+type autostartItem struct {
+	DesktopFile string
+	Priority    string
+	State       string
+	Reason      string `json:",omitempty"`
+	LaunchTime  int64  // unix time in milliseconds, 0 means not launched
+	DoneTime    int64  // unix time in milliseconds
+
+	priority int
+	delay    time.Duration
+	wmClass  string
+	cookie   string
+	timer    *time.Timer
+	pid      int // 最近一次启动的进程，D-Bus 激活的应用为 0
+}
+
+type autostartQueue struct {
+	mu          sync.Mutex
+	concurrency int
+	timeout     time.Duration
+	items       []*autostartItem
+	waiting     []*autostartItem
+	launching   map[string]*autostartItem // key 是 cookie
+
+	launch  func(item *autostartItem) error
+	getPids func(desktopFile string) []int
+}
+
+func newAutostartQueue(concurrency int, launch func(item *autostartItem) error,
+	getPids func(desktopFile string) []int) *autostartQueue {
+	if concurrency <= 0 {
+		concurrency = defaultAutostartConcurrency
+	}
+	return &autostartQueue{
+		concurrency: concurrency,
+		timeout:     autostartSlotTimeout,
+		launching:   make(map[string]*autostartItem),
+		launch:      launch,
+		getPids:     getPids,
+	}
+}
+
+func newAutostartItem(desktopFile string) *autostartItem {
+	item := &autostartItem{
+		DesktopFile: desktopFile,
+		priority:    autostartPriorityNormal,
+		cookie:      genUuid(),
+	}
+	appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile(desktopFile)
+	if err != nil {
+		logger.Warning(err)
+	} else {
+		priority, _ := appInfo.GetString(desktopappinfo.MainSection, KeyXDeepinAutostartPriority)
+		item.priority = parseAutostartPriority(priority)
+		item.wmClass, _ = appInfo.GetString(desktopappinfo.MainSection, KeyStartupWMClass)
+		item.delay, err = getDelayTime(desktopFile)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	item.Priority = autostartPriorityNames[item.priority]
+	return item
+}
+
+func (q *autostartQueue) setConcurrency(concurrency int) {
+	if concurrency <= 0 {
+		concurrency = defaultAutostartConcurrency
+	}
+	q.mu.Lock()
+	q.concurrency = concurrency
+	q.mu.Unlock()
+	q.schedule()
+}
+
+// add 把应用加入队列，有 X-GNOME-Autostart-Delay 的应用在延迟结束后才加入
+func (q *autostartQueue) add(item *autostartItem) {
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	if item.delay > 0 {
+		item.State = autostartStateDelayed
+		q.mu.Unlock()
+		time.AfterFunc(item.delay, func() {
+			q.enqueue(item)
+		})
+		return
+	}
+	q.mu.Unlock()
+	q.enqueue(item)
+}
+
+func (q *autostartQueue) enqueue(item *autostartItem) {
+	q.mu.Lock()
+	item.State = autostartStateWaiting
+	q.waiting = append(q.waiting, item)
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		return q.waiting[i].priority < q.waiting[j].priority
+	})
+	q.mu.Unlock()
+	q.schedule()
+}
+
+// schedule 在有空位时启动等待中优先级最高的应用
+func (q *autostartQueue) schedule() {
+	q.mu.Lock()
+	var items []*autostartItem
+	for len(q.launching) < q.concurrency && len(q.waiting) > 0 {
+		item := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		item.State = autostartStateLaunching
+		item.LaunchTime = toMilliseconds(time.Now())
+		q.launching[item.cookie] = item
+		item.timer = time.AfterFunc(q.timeout, func() {
+			q.release(item, autostartReasonTimeout)
+		})
+		items = append(items, item)
+	}
+	q.mu.Unlock()
+
+	for _, item := range items {
+		go func(item *autostartItem) {
+			logger.Debugf("autostart %s, priority %s", item.DesktopFile, item.Priority)
+			err := q.launch(item)
+			if err != nil {
+				logger.Warning(err)
+				q.release(item, autostartReasonFailed)
+			}
+		}(item)
+	}
+}
+
+// release 让出应用占用的位置
+func (q *autostartQueue) release(item *autostartItem, reason string) {
+	q.mu.Lock()
+	if q.launching[item.cookie] != item {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.launching, item.cookie)
+	item.timer.Stop()
+	item.State = autostartStateDone
+	item.Reason = reason
+	item.DoneTime = toMilliseconds(time.Now())
+	q.mu.Unlock()
+	logger.Debugf("autostart %s done: %s", item.DesktopFile, reason)
+	q.schedule()
+}
+
+// releaseCookie 让出 cookie 对应的应用占用的位置，cookie 属于启动中的自启动应用时返回 true
+func (q *autostartQueue) releaseCookie(cookie, reason string) bool {
+	if cookie == "" {
+		return false
+	}
+	q.mu.Lock()
+	item := q.launching[cookie]
+	q.mu.Unlock()
+	if item == nil {
+		return false
+	}
+	q.release(item, reason)
+	return true
+}
+
+// setPid 记录 cookie 对应的自启动应用的进程，应用重启后也会调用
+func (q *autostartQueue) setPid(cookie string, pid int) {
+	if cookie == "" {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, item := range q.items {
+		if item.cookie == cookie {
+			item.pid = pid
+			return
+		}
+	}
+}
+
+// getLaunchedPids 返回自启动队列为 desktopFile 启动的进程，进程可能已经退出
+func (q *autostartQueue) getLaunchedPids(desktopFile string) []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var pids []int
+	for _, item := range q.items {
+		if item.DesktopFile == desktopFile && item.pid != 0 {
+			pids = append(pids, item.pid)
+		}
+	}
+	return pids
+}
+
+// register 处理应用通过 SessionManager.Register 的注册，cookie 属于自启动应用时返回 true
+func (q *autostartQueue) register(cookie string) bool {
+	return q.releaseCookie(cookie, autostartReasonRegistered)
+}
+
+func (q *autostartQueue) handleNewWindow(info *windowInfo) {
+	q.mu.Lock()
+	var items []*autostartItem
+	for _, item := range q.launching {
+		items = append(items, item)
+	}
+	q.mu.Unlock()
+
+	for _, item := range items {
+		if isWindowOfApp(item.wmClass, q.getPids(item.DesktopFile), &info.wmClass, info.pid) {
+			q.release(item, autostartReasonWindowMapped)
+		}
+	}
+}
+
+type autostartQueueState struct {
+	Concurrency int
+	Launching   int
+	Waiting     int
+	Items       []*autostartItem
+}
+
+func (q *autostartQueue) dump() ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	state := autostartQueueState{
+		Concurrency: q.concurrency,
+		Launching:   len(q.launching),
+		Waiting:     len(q.waiting),
+		Items:       q.items,
+	}
+	return json.Marshal(state)
+}
+
+func (m *StartManager) launchAutostartItem(item *autostartItem) error {
+	var options map[string]dbus.Variant
+	appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile(item.DesktopFile)
+	// 通过 D-Bus 激活的应用不能传入环境变量，只能等待窗口映射或超时
+	if err == nil && !isDBusActivatable(appInfo) {
+		options = map[string]dbus.Variant{
+			launchOptionEnv: dbus.MakeVariant(map[string]string{
+				envSessionProcessCookieId: item.cookie,
+			}),
+		}
+	}
+	return m.launchAppWithOptions(item.DesktopFile, 0, nil, options)
+}
+
+// GetAutostartQueue 以 JSON 格式返回自启动队列的状态
+func (m *StartManager) GetAutostartQueue() (string, *dbus.Error) {
+	data, err := m.autostartQueue.dump()
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAutostartPriority(t *testing.T) {
+	assert.Equal(t, autostartPriorityHigh, parseAutostartPriority("High"))
+	assert.Equal(t, autostartPriorityLow, parseAutostartPriority("low"))
+	assert.Equal(t, autostartPriorityNormal, parseAutostartPriority(""))
+	assert.Equal(t, autostartPriorityNormal, parseAutostartPriority("urgent"))
+}
+
+func TestAutostartQueue(t *testing.T) {
+	var mu sync.Mutex
+	var launched []string
+	launchCh := make(chan struct{}, 10)
+	q := newAutostartQueue(2, func(item *autostartItem) error {
+		mu.Lock()
+		launched = append(launched, item.DesktopFile)
+		mu.Unlock()
+		launchCh <- struct{}{}
+		if item.DesktopFile == "fail.desktop" {
+			return errors.New("failed")
+		}
+		return nil
+	}, func(desktopFile string) []int {
+		if desktopFile == "b.desktop" {
+			return []int{100}
+		}
+		return nil
+	})
+	q.timeout = time.Hour
+
+	newItem := func(desktopFile string, priority int) *autostartItem {
+		return &autostartItem{
+			DesktopFile: desktopFile,
+			Priority:    autostartPriorityNames[priority],
+			priority:    priority,
+			cookie:      desktopFile,
+		}
+	}
+	waitLaunch := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case <-launchCh:
+			case <-time.After(time.Second):
+				t.Fatal("launch timed out")
+			}
+		}
+	}
+
+	// 占满两个位置后，其余的应用按优先级排队
+	q.add(newItem("a.desktop", autostartPriorityNormal))
+	q.add(newItem("b.desktop", autostartPriorityNormal))
+	waitLaunch(2)
+	q.add(newItem("low.desktop", autostartPriorityLow))
+	q.add(newItem("fail.desktop", autostartPriorityHigh))
+	q.add(newItem("c.desktop", autostartPriorityNormal))
+
+	assert.True(t, q.register("a.desktop"))
+	assert.False(t, q.register("a.desktop"))
+	// fail.desktop 启动失败后立即让出位置给 c.desktop
+	waitLaunch(2)
+
+	q.handleNewWindow(&windowInfo{pid: 100})
+	waitLaunch(1)
+
+	mu.Lock()
+	assert.ElementsMatch(t, []string{"a.desktop", "b.desktop"}, launched[:2])
+	assert.Equal(t, []string{"fail.desktop", "c.desktop", "low.desktop"}, launched[2:])
+	mu.Unlock()
+
+	data, err := q.dump()
+	assert.Nil(t, err)
+	var state autostartQueueState
+	assert.Nil(t, json.Unmarshal(data, &state))
+	assert.Equal(t, 2, state.Concurrency)
+	assert.Equal(t, 2, state.Launching)
+	assert.Equal(t, 0, state.Waiting)
+	assert.Len(t, state.Items, 5)
+	assert.Equal(t, autostartReasonRegistered, state.Items[0].Reason)
+	assert.Equal(t, autostartReasonWindowMapped, state.Items[1].Reason)
+	assert.Equal(t, autostartReasonFailed, state.Items[3].Reason)
+}
+
+func TestAutostartQueueTimeout(t *testing.T) {
+	done := make(chan struct{})
+	q := newAutostartQueue(1, func(item *autostartItem) error {
+		if item.DesktopFile == "b.desktop" {
+			close(done)
+		}
+		return nil
+	}, func(string) []int { return nil })
+	q.timeout = 10 * time.Millisecond
+
+	q.add(&autostartItem{DesktopFile: "a.desktop", cookie: "a"})
+	q.add(&autostartItem{DesktopFile: "b.desktop", cookie: "b"})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("slot was not released after timeout")
+	}
+}
+
+func TestAutostartQueueExited(t *testing.T) {
+	done := make(chan struct{})
+	q := newAutostartQueue(1, func(item *autostartItem) error {
+		if item.DesktopFile == "b.desktop" {
+			close(done)
+		}
+		return nil
+	}, func(string) []int { return nil })
+	q.timeout = time.Hour
+
+	a := &autostartItem{DesktopFile: "a.desktop", cookie: "a"}
+	q.add(a)
+	q.add(&autostartItem{DesktopFile: "b.desktop", cookie: "b"})
+	assert.False(t, q.releaseCookie("", autostartReasonExited))
+	assert.True(t, q.releaseCookie("a", autostartReasonExited))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("slot was not released after exit")
+	}
+	assert.Equal(t, autostartReasonExited, a.Reason)
+}
+
+func TestAutostartQueueLaunchedPids(t *testing.T) {
+	q := newAutostartQueue(1, func(*autostartItem) error { return nil },
+		func(string) []int { return nil })
+	q.timeout = time.Hour
+	q.add(&autostartItem{DesktopFile: "a.desktop", cookie: "a"})
+	q.add(&autostartItem{DesktopFile: "b.desktop", cookie: "b"})
+
+	assert.Empty(t, q.getLaunchedPids("a.desktop"))
+	q.setPid("a", 100)
+	q.setPid("", 200)
+	q.setPid("unknown", 300)
+	assert.Equal(t, []int{100}, q.getLaunchedPids("a.desktop"))
+	assert.Empty(t, q.getLaunchedPids("b.desktop"))
+
+	// 重启后记录新的进程
+	q.setPid("a", 101)
+	assert.Equal(t, []int{101}, q.getLaunchedPids("a.desktop"))
+}
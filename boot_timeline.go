@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 登录过程中的事件分类
+const (
+	bootCategoryPhase     = "phase"
+	bootCategoryCore      = "core"
+	bootCategoryGroup     = "group"
+	bootCategoryCommand   = "command"
+	bootCategoryAutostart = "autostart"
+	bootCategoryMark      = "mark"
+)
+
+const (
+	bootPhaseCoreComponents = "phase/core-components"
+	bootPhaseLaunchDDE      = "phase/launch-dde"
+	bootPhaseAutostartDelay = "phase/autostart-delay"
+)
+
+var sessionStageNames = map[int32]string{
+	SessionStageInitBegin: "InitBegin",
+	SessionStageInitEnd:   "InitEnd",
+	SessionStageCoreBegin: "CoreBegin",
+	SessionStageCoreEnd:   "CoreEnd",
+	SessionStageAppsBegin: "AppsBegin",
+	SessionStageAppsEnd:   "AppsEnd",
+}
+
+// BootEvent 是登录过程中的一个事件，时间都是相对 startdde 启动的毫秒数
+type BootEvent struct {
+	Id       string
+	Category string
+	Name     string
+	Start    int64
+	End      int64
+	Done     bool
+	Parent   string `json:",omitempty"` // 包含此事件的事件 id
+	After    string `json:",omitempty"` // 此事件等待结束的事件 id
+	Result   string `json:",omitempty"`
+}
+
+type BootStage struct {
+	Stage int32
+	Name  string
+	Time  int64
+}
+
+// BootTimeline 由 GetBootTimeline 返回
+type BootTimeline struct {
+	StartTime int64 // unix time in milliseconds
+	Now       int64
+	Stages    []BootStage
+	Events    []*BootEvent
+}
+
+// bootTimeline 收集登录过程中各阶段、核心组件、auto_launch.json 中的命令和自启动应用的时间，
+// 所有方法在 nil 上调用时什么也不做
+type bootTimeline struct {
+	mu     sync.Mutex
+	start  time.Time
+	stages []BootStage
+	events []*BootEvent
+}
+
+var _bootTimeline *bootTimeline
+
+func newBootTimeline(start time.Time) *bootTimeline {
+	return &bootTimeline{start: start}
+}
+
+func (t *bootTimeline) since(now time.Time) int64 {
+	return int64(now.Sub(t.start) / time.Millisecond)
+}
+
+type bootSpan struct {
+	t     *bootTimeline
+	event *BootEvent
+}
+
+// begin 开始一个事件，返回的 bootSpan 用于结束事件
+func (t *bootTimeline) begin(category, id, name, parent, after string) *bootSpan {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	event := &BootEvent{
+		Id:       id,
+		Category: category,
+		Name:     name,
+		Start:    t.since(time.Now()),
+		Parent:   parent,
+		After:    after,
+	}
+	t.events = append(t.events, event)
+	return &bootSpan{t: t, event: event}
+}
+
+func (s *bootSpan) end(result string) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	if s.event.Done {
+		return
+	}
+	s.event.End = s.t.since(time.Now())
+	s.event.Done = true
+	s.event.Result = result
+}
+
+// mark 记录一个时间点
+func (t *bootTimeline) mark(name string) {
+	t.begin(bootCategoryMark, "mark/"+name, name, "", "").end("")
+}
+
+func (t *bootTimeline) setStage(stage int32) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages = append(t.stages, BootStage{
+		Stage: stage,
+		Name:  sessionStageNames[stage],
+		Time:  t.since(time.Now()),
+	})
+}
+
+// getAutostartEvents 把自启动队列中已经启动的应用转换为事件，从启动到注册、映射窗口或超时
+func (t *bootTimeline) getAutostartEvents(items []autostartItem) []*BootEvent {
+	var events []*BootEvent
+	startTime := toMilliseconds(t.start)
+	for _, item := range items {
+		if item.LaunchTime == 0 {
+			continue
+		}
+		event := &BootEvent{
+			Id:       "autostart/" + item.DesktopFile,
+			Category: bootCategoryAutostart,
+			Name:     filepath.Base(item.DesktopFile),
+			Start:    item.LaunchTime - startTime,
+			After:    bootPhaseAutostartDelay,
+		}
+		if item.State == autostartStateDone {
+			event.End = item.DoneTime - startTime
+			event.Done = true
+			event.Result = item.Reason
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func (t *bootTimeline) dump(autostartItems []autostartItem) *BootTimeline {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timeline := &BootTimeline{
+		StartTime: toMilliseconds(t.start),
+		Now:       t.since(time.Now()),
+		Stages:    append([]BootStage{}, t.stages...),
+		Events:    []*BootEvent{},
+	}
+	for _, event := range t.events {
+		e := *event
+		timeline.Events = append(timeline.Events, &e)
+	}
+	timeline.Events = append(timeline.Events, t.getAutostartEvents(autostartItems)...)
+	return timeline
+}
+
+// getItems 返回自启动应用的副本
+func (q *autostartQueue) getItems() []autostartItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]autostartItem, len(q.items))
+	for i, item := range q.items {
+		items[i] = *item
+	}
+	return items
+}
+
+// GetBootTimeline 以 JSON 格式返回本次登录的启动时间线
+func (m *SessionManager) GetBootTimeline() (string, *dbus.Error) {
+	var items []autostartItem
+	if _startManager != nil {
+		items = _startManager.autostartQueue.getItems()
+	}
+	t := _bootTimeline
+	if t == nil {
+		t = newBootTimeline(_mainBeginTime)
+	}
+	data, err := json.Marshal(t.dump(items))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
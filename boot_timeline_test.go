@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootTimeline(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	timeline := newBootTimeline(start)
+
+	phase := timeline.begin(bootCategoryPhase, bootPhaseCoreComponents, "core-components", "", "")
+	span := timeline.begin(bootCategoryCore, "core/dde-dock", "dde-dock", bootPhaseCoreComponents,
+		"core/dde-session-daemon")
+	timeline.mark("call com.deepin.dde.Dock callShow")
+	span.end("ok")
+	// 重复结束不改变结果
+	span.end("failed")
+	timeline.setStage(SessionStageCoreBegin)
+
+	items := []autostartItem{
+		{DesktopFile: "/etc/xdg/autostart/a.desktop", State: autostartStateDone,
+			Reason: autostartReasonRegistered, LaunchTime: toMilliseconds(start) + 3000,
+			DoneTime: toMilliseconds(start) + 3500},
+		{DesktopFile: "/etc/xdg/autostart/b.desktop", State: autostartStateLaunching,
+			LaunchTime: toMilliseconds(start) + 4000},
+		{DesktopFile: "/etc/xdg/autostart/c.desktop", State: autostartStateWaiting},
+	}
+	result := timeline.dump(items)
+	assert.Equal(t, toMilliseconds(start), result.StartTime)
+	assert.True(t, result.Now >= 1000)
+	assert.Equal(t, []BootStage{{Stage: SessionStageCoreBegin, Name: "CoreBegin",
+		Time: result.Stages[0].Time}}, result.Stages)
+	assert.Len(t, result.Events, 5)
+
+	assert.False(t, result.Events[0].Done)
+	dock := result.Events[1]
+	assert.Equal(t, "dde-dock", dock.Name)
+	assert.Equal(t, bootPhaseCoreComponents, dock.Parent)
+	assert.Equal(t, "core/dde-session-daemon", dock.After)
+	assert.True(t, dock.Done)
+	assert.Equal(t, "ok", dock.Result)
+	assert.True(t, dock.Start >= 1000 && dock.End >= dock.Start)
+
+	mark := result.Events[2]
+	assert.Equal(t, bootCategoryMark, mark.Category)
+	assert.Equal(t, mark.Start, mark.End)
+
+	a := result.Events[3]
+	assert.Equal(t, &BootEvent{Id: "autostart//etc/xdg/autostart/a.desktop", Category: bootCategoryAutostart,
+		Name: "a.desktop", Start: 3000, End: 3500, Done: true, After: bootPhaseAutostartDelay,
+		Result: autostartReasonRegistered}, a)
+	b := result.Events[4]
+	assert.Equal(t, int64(4000), b.Start)
+	assert.False(t, b.Done)
+
+	// dump 返回的是副本
+	phase.end("")
+	assert.False(t, result.Events[0].Done)
+}
+
+func TestBootTimelineNil(t *testing.T) {
+	var timeline *bootTimeline
+	span := timeline.begin(bootCategoryCore, "core/kwin", "kwin", "", "")
+	assert.Nil(t, span)
+	span.end("ok")
+	timeline.mark("test")
+	timeline.setStage(SessionStageInitBegin)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	sessionManagerServiceName = "com.deepin.SessionManager"
+	sessionManagerObjPath     = "/com/deepin/SessionManager"
+	sessionManagerInterface   = sessionManagerServiceName
+
+	categoryPhase = "phase"
+	categoryGroup = "group"
+	categoryMark  = "mark"
+)
+
+var optFile = flag.String("file", "", "read the timeline from a JSON file saved by the dump command")
+
+func init() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-file FILE] [COMMAND]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, "Analyze the login timeline of the current session.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Commands:")
+		fmt.Fprintln(os.Stderr, "  time            print the session stages (default)")
+		fmt.Fprintln(os.Stderr, "  blame           list components and applications by startup time")
+		fmt.Fprintln(os.Stderr, "  critical-chain  print the chain of components the login waited for")
+		fmt.Fprintln(os.Stderr, "  plot            output an SVG graph of the timeline")
+		fmt.Fprintln(os.Stderr, "  dump            output the raw JSON timeline")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+}
+
+type event struct {
+	Id       string
+	Category string
+	Name     string
+	Start    int64
+	End      int64
+	Done     bool
+	Parent   string
+	After    string
+	Result   string
+}
+
+func (e *event) duration() int64 {
+	return e.End - e.Start
+}
+
+type stage struct {
+	Stage int32
+	Name  string
+	Time  int64
+}
+
+type timeline struct {
+	StartTime int64
+	Now       int64
+	Stages    []stage
+	Events    []*event
+}
+
+func formatMs(ms int64) string {
+	if ms < 1000 && ms > -1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return fmt.Sprintf("%.3fs", float64(ms)/1000)
+}
+
+func isLeaf(e *event) bool {
+	return e.Category != categoryPhase && e.Category != categoryGroup && e.Category != categoryMark
+}
+
+func printTime(t *timeline) {
+	if len(t.Stages) == 0 {
+		fmt.Println("No session stage recorded.")
+	}
+	for _, s := range t.Stages {
+		fmt.Printf("%-10s @%s\n", s.Name, formatMs(s.Time))
+	}
+	var last *event
+	for _, e := range t.Events {
+		if isLeaf(e) && e.Done && (last == nil || e.End > last.End) {
+			last = e
+		}
+	}
+	if last != nil {
+		fmt.Printf("Last component %s finished @%s\n", last.Name, formatMs(last.End))
+	}
+}
+
+func printBlame(t *timeline) {
+	var events []*event
+	for _, e := range t.Events {
+		if isLeaf(e) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].duration() > events[j].duration()
+	})
+	for _, e := range events {
+		if !e.Done {
+			continue
+		}
+		result := ""
+		if e.Result != "" && e.Result != "ok" {
+			result = " (" + e.Result + ")"
+		}
+		fmt.Printf("%10s %s [%s]%s\n", formatMs(e.duration()), e.Name, e.Category, result)
+	}
+	for _, e := range events {
+		if !e.Done {
+			fmt.Printf("%10s %s [%s] (not finished)\n", "-", e.Name, e.Category)
+		}
+	}
+}
+
+// lastLeaf 返回事件中最后结束的子事件，没有子事件时返回事件本身
+func lastLeaf(e *event, children map[string][]*event) *event {
+	for {
+		var last *event
+		for _, child := range children[e.Id] {
+			if child.Done && (last == nil || child.End > last.End) {
+				last = child
+			}
+		}
+		if last == nil {
+			return e
+		}
+		e = last
+	}
+}
+
+// criticalChain 从最后结束的组件开始，沿着它等待的事件向前查找
+func criticalChain(t *timeline) []*event {
+	byId := make(map[string]*event)
+	children := make(map[string][]*event)
+	var last *event
+	for _, e := range t.Events {
+		byId[e.Id] = e
+		if e.Parent != "" {
+			children[e.Parent] = append(children[e.Parent], e)
+		}
+		if isLeaf(e) && e.Done && (last == nil || e.End > last.End) {
+			last = e
+		}
+	}
+
+	var chain []*event
+	visited := make(map[string]bool)
+	for e := last; e != nil && !visited[e.Id]; {
+		visited[e.Id] = true
+		chain = append(chain, e)
+		dep := byId[e.After]
+		if dep == nil {
+			break
+		}
+		e = lastLeaf(dep, children)
+	}
+	return chain
+}
+
+func printCriticalChain(t *timeline) {
+	chain := criticalChain(t)
+	if len(chain) == 0 {
+		fmt.Println("No finished component recorded.")
+		return
+	}
+	fmt.Println(`The time when the component finished starting is printed after the "@" character.`)
+	fmt.Println(`The time the component took to start is printed after the "+" character.`)
+	fmt.Println()
+	for i, e := range chain {
+		prefix := ""
+		if i > 0 {
+			prefix = strings.Repeat("  ", i-1) + "└─"
+		}
+		fmt.Printf("%s%s @%s +%s\n", prefix, e.Name, formatMs(e.End), formatMs(e.duration()))
+	}
+}
+
+var categoryColors = map[string]string{
+	"phase":     "#bbbbbb",
+	"core":      "#e06c5c",
+	"group":     "#88a8d8",
+	"command":   "#5c8ee0",
+	"autostart": "#6cc06c",
+}
+
+const (
+	plotPxPerSecond = 100
+	plotRowHeight   = 20
+	plotLeft        = 10
+	plotTop         = 40
+)
+
+func writePlot(w io.Writer, t *timeline) {
+	var events []*event
+	for _, e := range t.Events {
+		if e.Category != categoryMark {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start < events[j].Start
+	})
+
+	x := func(ms int64) int64 {
+		return plotLeft + ms*plotPxPerSecond/1000
+	}
+	end := t.Now
+	for _, e := range events {
+		if e.End > end {
+			end = e.End
+		}
+	}
+	seconds := end/1000 + 1
+	width := x(seconds*1000) + 300
+	height := int64(plotTop + (len(events)+1)*plotRowHeight + 20)
+
+	fmt.Fprintf(w, `<?xml version="1.0" standalone="no"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">
+<style>
+text { font-family: sans-serif; font-size: 12px; }
+.grid { stroke: #dddddd; stroke-width: 1; }
+.stage { stroke: #a040a0; stroke-width: 1; stroke-dasharray: 4,2; }
+.mark { stroke: #808080; stroke-width: 1; stroke-dasharray: 1,3; }
+</style>
+<rect width="100%%" height="100%%" fill="white"/>
+`, width, height)
+
+	for s := int64(0); s <= seconds; s++ {
+		fmt.Fprintf(w, `<line class="grid" x1="%d" y1="%d" x2="%d" y2="%d"/>`+"\n",
+			x(s*1000), plotTop-10, x(s*1000), height-20)
+		fmt.Fprintf(w, `<text x="%d" y="%d">%ds</text>`+"\n", x(s*1000)+2, plotTop-15, s)
+	}
+	for _, s := range t.Stages {
+		fmt.Fprintf(w, `<line class="stage" x1="%d" y1="%d" x2="%d" y2="%d"><title>%s @%s</title></line>`+"\n",
+			x(s.Time), plotTop-10, x(s.Time), height-20, html.EscapeString(s.Name), formatMs(s.Time))
+		fmt.Fprintf(w, `<text x="%d" y="%d" fill="#a040a0">%s</text>`+"\n",
+			x(s.Time)+2, height-5, html.EscapeString(s.Name))
+	}
+	for _, e := range t.Events {
+		if e.Category == categoryMark {
+			fmt.Fprintf(w, `<line class="mark" x1="%d" y1="%d" x2="%d" y2="%d"><title>%s @%s</title></line>`+"\n",
+				x(e.Start), plotTop-10, x(e.Start), height-20, html.EscapeString(e.Name), formatMs(e.Start))
+		}
+	}
+
+	for i, e := range events {
+		y := int64(plotTop + i*plotRowHeight)
+		barEnd := e.End
+		opacity := "1"
+		label := fmt.Sprintf("%s (%s)", e.Name, formatMs(e.duration()))
+		if !e.Done {
+			barEnd = t.Now
+			opacity = "0.4"
+			label = e.Name + " (not finished)"
+		}
+		barWidth := x(barEnd) - x(e.Start)
+		if barWidth < 1 {
+			barWidth = 1
+		}
+		color := categoryColors[e.Category]
+		if color == "" {
+			color = "#999999"
+		}
+		fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" fill-opacity="%s">`+
+			`<title>%s [%s] @%s %s</title></rect>`+"\n",
+			x(e.Start), y, barWidth, plotRowHeight-4, color, opacity,
+			html.EscapeString(e.Name), e.Category, formatMs(e.Start), html.EscapeString(e.Result))
+		fmt.Fprintf(w, `<text x="%d" y="%d">%s</text>`+"\n",
+			x(e.Start)+barWidth+4, y+plotRowHeight-8, html.EscapeString(label))
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+func getTimeline() ([]byte, error) {
+	if *optFile != "" {
+		if *optFile == "-" {
+			return ioutil.ReadAll(os.Stdin)
+		}
+		return ioutil.ReadFile(*optFile)
+	}
+	sessionBus, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+	obj := sessionBus.Object(sessionManagerServiceName, sessionManagerObjPath)
+	var result string
+	err = obj.Call(sessionManagerInterface+".GetBootTimeline", 0).Store(&result)
+	return []byte(result), err
+}
+
+func main() {
+	flag.Parse()
+	command := "time"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	data, err := getTimeline()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if command == "dump" {
+		var out bytes.Buffer
+		err = json.Indent(&out, data, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(out.String())
+		return
+	}
+
+	var t timeline
+	err = json.Unmarshal(data, &t)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch command {
+	case "time":
+		printTime(&t)
+	case "blame":
+		printBlame(&t)
+	case "critical-chain":
+		printCriticalChain(&t)
+	case "plot":
+		writePlot(os.Stdout, &t)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
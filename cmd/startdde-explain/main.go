@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	sessionManagerServiceName = "com.deepin.SessionManager"
+	startManagerObjPath       = "/com/deepin/StartManager"
+	startManagerInterface     = "com.deepin.StartManager"
+)
+
+var (
+	optAction = flag.String("action", "", "explain the desktop action instead of the main entry")
+	optJSON   = flag.Bool("json", false, "print the raw JSON returned by StartManager")
+)
+
+func init() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-action ACTION] [-json] DESKTOP_FILE [FILE...]\n",
+			filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr, "Show how startdde would launch the application, without launching it.")
+		flag.PrintDefaults()
+	}
+}
+
+type explanation struct {
+	DesktopFile     string
+	Action          string
+	AppId           string
+	Method          string
+	SingleInstance  bool
+	RunningInstance bool
+	Exec            string
+	Files           []string
+	CmdPrefixes     []string
+	CmdSuffixes     []string
+	Env             map[string]string
+	Terminal        []string
+	StartupNotify   bool
+	CGroupMethod    string
+	CGroup          string
+	Limits          map[string]uint64
+	RestartPolicy   string
+	OutputCapture   string
+	CpuBoost        struct {
+		Seconds int32
+		Reason  string
+	}
+	Memory struct {
+		Enabled      bool
+		Sufficient   bool
+		NeededMemory uint64
+	}
+	Error string
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`;&|<>()*?") {
+			arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]string:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	case map[string]uint64:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func printExplanation(ex *explanation) {
+	fmt.Printf("Desktop file:    %s\n", ex.DesktopFile)
+	if ex.Action != "" {
+		fmt.Printf("Action:          %s\n", ex.Action)
+	}
+	fmt.Printf("App id:          %s\n", ex.AppId)
+	fmt.Printf("Method:          %s\n", ex.Method)
+	if ex.SingleInstance {
+		fmt.Println("Single instance: yes, a running instance is activated instead")
+		if ex.RunningInstance {
+			fmt.Println("Running:         yes")
+		}
+	}
+	fmt.Printf("Exec:            %s\n", ex.Exec)
+	if len(ex.Files) > 0 {
+		fmt.Printf("Files:           %s\n", quoteArgs(ex.Files))
+	}
+	fmt.Printf("Cmd prefixes:    %s\n", quoteArgs(ex.CmdPrefixes))
+	fmt.Printf("Cmd suffixes:    %s\n", quoteArgs(ex.CmdSuffixes))
+	fmt.Printf("Command:         %s\n", strings.TrimSpace(quoteArgs(ex.CmdPrefixes)+" "+
+		ex.Exec+" "+quoteArgs(ex.CmdSuffixes)))
+	for _, name := range sortedKeys(ex.Env) {
+		fmt.Printf("Env:             %s=%s\n", name, ex.Env[name])
+	}
+	if ex.StartupNotify {
+		fmt.Println("Startup notify:  yes")
+	}
+	fmt.Printf("CGroup:          %s %s\n", ex.CGroupMethod, ex.CGroup)
+	for _, name := range sortedKeys(ex.Limits) {
+		if ex.Limits[name] != 0 {
+			fmt.Printf("Limit:           %s=%d\n", name, ex.Limits[name])
+		}
+	}
+	if ex.RestartPolicy != "" {
+		fmt.Printf("Restart policy:  %s\n", ex.RestartPolicy)
+	}
+	if ex.OutputCapture != "" {
+		fmt.Printf("Output capture:  %s\n", ex.OutputCapture)
+	}
+	if ex.CpuBoost.Seconds > 0 {
+		fmt.Printf("CPU boost:       %ds\n", ex.CpuBoost.Seconds)
+	} else {
+		fmt.Printf("CPU boost:       no, %s\n", ex.CpuBoost.Reason)
+	}
+	switch {
+	case !ex.Memory.Enabled:
+		fmt.Println("Memory check:    disabled")
+	case ex.Memory.Sufficient:
+		fmt.Println("Memory check:    sufficient")
+	default:
+		fmt.Printf("Memory check:    insufficient, need %d KB more, launch will wait\n",
+			ex.Memory.NeededMemory)
+	}
+	if ex.Error != "" {
+		fmt.Printf("Error:           %s\n", ex.Error)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	desktopFile := flag.Arg(0)
+	if !filepath.IsAbs(desktopFile) && strings.Contains(desktopFile, "/") {
+		abs, err := filepath.Abs(desktopFile)
+		if err == nil {
+			desktopFile = abs
+		}
+	}
+	files := flag.Args()[1:]
+	if files == nil {
+		files = []string{}
+	}
+
+	sessionBus, err := dbus.SessionBus()
+	if err != nil {
+		log.Fatal(err)
+	}
+	obj := sessionBus.Object(sessionManagerServiceName, startManagerObjPath)
+	var result string
+	err = obj.Call(startManagerInterface+".ExplainLaunch", 0, desktopFile, *optAction, files).
+		Store(&result)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *optJSON {
+		var out bytes.Buffer
+		err = json.Indent(&out, []byte(result), "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(out.String())
+		return
+	}
+
+	var ex explanation
+	err = json.Unmarshal([]byte(result), &ex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printExplanation(&ex)
+}
@@ -0,0 +1,28 @@
+package main
+
+// #cgo pkg-config: gio-2.0
+// #include <stdlib.h>
+// #include <gio/gio.h>
+import "C"
+import "unsafe"
+
+// guessContentType 用 GIO 根据文件名和文件开头的内容判断 MIME 类型，
+// GIO 使用 shared-mime-info 的数据库，能识别子类型和 glob、magic 规则
+func guessContentType(filename string, data []byte) string {
+	cFilename := C.CString(filename)
+	defer C.free(unsafe.Pointer(cFilename))
+
+	var cData *C.guchar
+	if len(data) > 0 {
+		cData = (*C.guchar)(unsafe.Pointer(&data[0]))
+	}
+	contentType := C.g_content_type_guess(cFilename, cData, C.gsize(len(data)), nil)
+	defer C.g_free(C.gpointer(contentType))
+
+	mimeType := C.g_content_type_get_mime_type(contentType)
+	if mimeType == nil {
+		return C.GoString(contentType)
+	}
+	defer C.g_free(C.gpointer(mimeType))
+	return C.GoString(mimeType)
+}
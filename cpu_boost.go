@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+// 应用启动时临时把 CPU 调度策略设为 performance，持续时间按优先级取:
+// 用户设置的时间、学习到的启动时间、app_startup.conf 中的默认时间。
+const (
+	// 启动时间短于此值的应用不需要加速
+	cpuBoostMinStartup = 500 * time.Millisecond
+	cpuBoostMaxSeconds = 15
+	// 超过此时间还没有映射窗口则放弃本次学习
+	cpuBoostLearnTimeout = 30 * time.Second
+	// 新的启动时间在学习结果中所占的比重
+	cpuBoostLearnWeight = 0.3
+)
+
+type cpuBoostConfig struct {
+	Enabled        bool
+	BoostOnBattery bool
+	// 学习到的启动时间，单位为毫秒
+	Learned map[string]int64
+	// 用户设置的加速时间，单位为秒，0 表示不加速
+	Overrides map[string]int32
+}
+
+type cpuBoostLearning struct {
+	startTime time.Time
+	wmClass   string
+}
+
+type cpuBoostManager struct {
+	mu      sync.Mutex
+	file    string
+	modTime time.Time
+	cfg     cpuBoostConfig
+	// key 是 desktop 文件
+	learning map[string]*cpuBoostLearning
+
+	getPids func(desktopFile string) []int
+}
+
+func getCpuBoostFile() string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "cpu-boost.json")
+}
+
+func getCpuBoostAppId(desktopFile string) string {
+	return strings.TrimSuffix(filepath.Base(desktopFile), desktopExt)
+}
+
+func newCpuBoostManager(file string, getPids func(desktopFile string) []int) *cpuBoostManager {
+	cb := &cpuBoostManager{
+		file:     file,
+		learning: make(map[string]*cpuBoostLearning),
+		getPids:  getPids,
+	}
+	cb.cfg.Enabled = true
+	cb.load()
+	return cb
+}
+
+// load 在文件被修改后重新加载，以便用户直接编辑文件，需要在持有 cb.mu 的情况下调用
+func (cb *cpuBoostManager) load() {
+	fileInfo, err := os.Stat(cb.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(err)
+		}
+	} else if !fileInfo.ModTime().Equal(cb.modTime) {
+		cb.modTime = fileInfo.ModTime()
+		var data []byte
+		data, err = ioutil.ReadFile(cb.file)
+		if err == nil {
+			cfg := cpuBoostConfig{Enabled: true}
+			err = json.Unmarshal(data, &cfg)
+			if err == nil {
+				cb.cfg = cfg
+			}
+		}
+		if err != nil {
+			logger.Warning("failed to load cpu boost config:", err)
+		}
+	}
+
+	if cb.cfg.Learned == nil {
+		cb.cfg.Learned = make(map[string]int64)
+	}
+	if cb.cfg.Overrides == nil {
+		cb.cfg.Overrides = make(map[string]int32)
+	}
+}
+
+// save 需要在持有 cb.mu 的情况下调用
+func (cb *cpuBoostManager) save() error {
+	data, err := json.MarshalIndent(cb.cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(cb.file), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(cb.file, data, 0644)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := os.Stat(cb.file)
+	if err == nil {
+		cb.modTime = fileInfo.ModTime()
+	}
+	return nil
+}
+
+func learnedToSeconds(ms int64) int32 {
+	if time.Duration(ms)*time.Millisecond < cpuBoostMinStartup {
+		return 0
+	}
+	seconds := int32(math.Ceil(float64(ms) / 1000))
+	if seconds > cpuBoostMaxSeconds {
+		seconds = cpuBoostMaxSeconds
+	}
+	return seconds
+}
+
+// getSeconds 返回应用启动时加速的秒数，ok 为 false 表示不加速
+func (cb *cpuBoostManager) getSeconds(appId string, defaults map[string]int32) (int32, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.load()
+	return cb.getSecondsNoLock(appId, defaults)
+}
+
+func (cb *cpuBoostManager) getSecondsNoLock(appId string, defaults map[string]int32) (int32, bool) {
+	if !cb.cfg.Enabled {
+		return 0, false
+	}
+	if seconds, ok := cb.cfg.Overrides[appId]; ok {
+		return seconds, seconds > 0
+	}
+	if ms, ok := cb.cfg.Learned[appId]; ok {
+		seconds := learnedToSeconds(ms)
+		return seconds, seconds > 0
+	}
+	seconds, ok := defaults[appId]
+	return seconds, ok && seconds > 0
+}
+
+// beginLearning 开始记录应用的启动时间，直到应用映射第一个窗口
+func (cb *cpuBoostManager) beginLearning(appInfo *desktopappinfo.DesktopAppInfo) {
+	desktopFile := appInfo.GetFileName()
+	wmClass, _ := appInfo.GetString(desktopappinfo.MainSection, KeyStartupWMClass)
+	learning := &cpuBoostLearning{
+		startTime: time.Now(),
+		wmClass:   wmClass,
+	}
+	cb.mu.Lock()
+	cb.learning[desktopFile] = learning
+	cb.mu.Unlock()
+
+	time.AfterFunc(cpuBoostLearnTimeout, func() {
+		cb.mu.Lock()
+		if cb.learning[desktopFile] == learning {
+			delete(cb.learning, desktopFile)
+		}
+		cb.mu.Unlock()
+	})
+}
+
+func (cb *cpuBoostManager) handleNewWindow(info *windowInfo) {
+	cb.mu.Lock()
+	learning := make(map[string]*cpuBoostLearning, len(cb.learning))
+	for desktopFile, l := range cb.learning {
+		learning[desktopFile] = l
+	}
+	cb.mu.Unlock()
+
+	now := time.Now()
+	for desktopFile, l := range learning {
+		if isWindowOfApp(l.wmClass, cb.getPids(desktopFile), &info.wmClass, info.pid) {
+			cb.endLearning(desktopFile, l, now.Sub(l.startTime))
+		}
+	}
+}
+
+func (cb *cpuBoostManager) endLearning(desktopFile string, l *cpuBoostLearning, duration time.Duration) {
+	appId := getCpuBoostAppId(desktopFile)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.learning[desktopFile] != l {
+		return
+	}
+	delete(cb.learning, desktopFile)
+
+	cb.load()
+	ms := int64(duration / time.Millisecond)
+	if old, ok := cb.cfg.Learned[appId]; ok {
+		ms = int64(float64(old)*(1-cpuBoostLearnWeight) + float64(ms)*cpuBoostLearnWeight)
+	}
+	cb.cfg.Learned[appId] = ms
+	logger.Debugf("app %s startup duration %v, learned %dms", appId, duration, ms)
+	err := cb.save()
+	if err != nil {
+		logger.Warning("failed to save cpu boost config:", err)
+	}
+}
+
+func (cb *cpuBoostManager) setOverride(appId string, seconds int32) error {
+	if appId == "" {
+		return errors.New("app id is empty")
+	}
+	if seconds > cpuBoostMaxSeconds {
+		return fmt.Errorf("seconds must not be greater than %d", cpuBoostMaxSeconds)
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.load()
+	if seconds < 0 {
+		delete(cb.cfg.Overrides, appId)
+	} else {
+		cb.cfg.Overrides[appId] = seconds
+	}
+	return cb.save()
+}
+
+func (cb *cpuBoostManager) setOptions(enabled, boostOnBattery bool) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.load()
+	cb.cfg.Enabled = enabled
+	cb.cfg.BoostOnBattery = boostOnBattery
+	return cb.save()
+}
+
+// resetLearned 清除学习到的启动时间，appId 为空则清除全部
+func (cb *cpuBoostManager) resetLearned(appId string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.load()
+	if appId == "" {
+		cb.cfg.Learned = make(map[string]int64)
+	} else {
+		delete(cb.cfg.Learned, appId)
+	}
+	return cb.save()
+}
+
+func (cb *cpuBoostManager) boostOnBattery() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.cfg.BoostOnBattery
+}
+
+// CpuBoostAppInfo 是 GetCpuBoostTable 返回的每个应用的加速信息
+type CpuBoostAppInfo struct {
+	Default   int32 `json:",omitempty"`
+	Learned   int64 `json:",omitempty"` // 毫秒
+	Override  *int32
+	Effective int32
+}
+
+type cpuBoostTable struct {
+	Enabled        bool
+	BoostOnBattery bool
+	Apps           map[string]*CpuBoostAppInfo
+}
+
+func (cb *cpuBoostManager) dump(defaults map[string]int32) ([]byte, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.load()
+
+	table := cpuBoostTable{
+		Enabled:        cb.cfg.Enabled,
+		BoostOnBattery: cb.cfg.BoostOnBattery,
+		Apps:           make(map[string]*CpuBoostAppInfo),
+	}
+	getInfo := func(appId string) *CpuBoostAppInfo {
+		info := table.Apps[appId]
+		if info == nil {
+			info = &CpuBoostAppInfo{}
+			table.Apps[appId] = info
+		}
+		return info
+	}
+	for appId, seconds := range defaults {
+		getInfo(appId).Default = seconds
+	}
+	for appId, ms := range cb.cfg.Learned {
+		getInfo(appId).Learned = ms
+	}
+	for appId, seconds := range cb.cfg.Overrides {
+		seconds := seconds
+		getInfo(appId).Override = &seconds
+	}
+	for appId, info := range table.Apps {
+		info.Effective, _ = cb.getSecondsNoLock(appId, defaults)
+	}
+	return json.Marshal(table)
+}
+
+// shouldCpuBoost 在使用电池且用户没有允许时或开启了节能模式时不加速
+func (m *StartManager) shouldCpuBoost() bool {
+	powerSaving, err := m.systemPower.PowerSavingModeEnabled().Get(0)
+	if err != nil {
+		logger.Warning(err)
+	} else if powerSaving {
+		return false
+	}
+
+	if m.cpuBoost.boostOnBattery() {
+		return true
+	}
+	onBattery, err := m.systemPower.OnBattery().Get(0)
+	if err != nil {
+		logger.Warning(err)
+		return true
+	}
+	return !onBattery
+}
+
+// beginCpuBoostLearning 记录应用本次的启动时间，第一次调用时开始监听窗口
+func (m *StartManager) beginCpuBoostLearning(appInfo *desktopappinfo.DesktopAppInfo) {
+	m.cpuBoostOnce.Do(func() {
+		m.startupNotifier.addWindowHandler(m.cpuBoost.handleNewWindow)
+	})
+	m.cpuBoost.beginLearning(appInfo)
+}
+
+// GetCpuBoostTable 以 JSON 格式返回各应用启动加速的默认、学习到的、用户设置的和实际使用的时间
+func (m *StartManager) GetCpuBoostTable() (string, *dbus.Error) {
+	data, err := m.cpuBoost.dump(m.cpuFreqAdjustMap)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SetAppCpuBoost 设置应用启动加速的秒数，0 表示不加速，小于 0 表示取消设置
+func (m *StartManager) SetAppCpuBoost(sender dbus.Sender, appId string, seconds int32) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.cpuBoost.setOverride(appId, seconds)
+	return dbusutil.ToError(err)
+}
+
+func (m *StartManager) SetCpuBoostOptions(sender dbus.Sender, enabled, boostOnBattery bool) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.cpuBoost.setOptions(enabled, boostOnBattery)
+	return dbusutil.ToError(err)
+}
+
+// ResetCpuBoostLearned 清除学习到的启动时间，appId 为空则清除全部
+func (m *StartManager) ResetCpuBoostLearned(sender dbus.Sender, appId string) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.cpuBoost.resetLearned(appId)
+	return dbusutil.ToError(err)
+}
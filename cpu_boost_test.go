@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLearnedToSeconds(t *testing.T) {
+	assert.Equal(t, int32(0), learnedToSeconds(300))
+	assert.Equal(t, int32(1), learnedToSeconds(500))
+	assert.Equal(t, int32(3), learnedToSeconds(2100))
+	assert.Equal(t, int32(cpuBoostMaxSeconds), learnedToSeconds(60000))
+}
+
+func TestCpuBoostManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-cpu-boost")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "cpu-boost.json")
+	defaults := map[string]int32{"deepin-music": 3, "deepin-draw": 3}
+	cb := newCpuBoostManager(file, func(desktopFile string) []int { return []int{100} })
+
+	seconds, ok := cb.getSeconds("deepin-music", defaults)
+	assert.True(t, ok)
+	assert.Equal(t, int32(3), seconds)
+	_, ok = cb.getSeconds("deepin-editor", defaults)
+	assert.False(t, ok)
+
+	// 学习到的时间优先于默认时间
+	desktopFile := "/usr/share/applications/deepin-music.desktop"
+	l := &cpuBoostLearning{startTime: time.Now()}
+	cb.learning[desktopFile] = l
+	cb.endLearning(desktopFile, l, 5*time.Second)
+	seconds, ok = cb.getSeconds("deepin-music", defaults)
+	assert.True(t, ok)
+	assert.Equal(t, int32(5), seconds)
+
+	l = &cpuBoostLearning{startTime: time.Now()}
+	cb.learning[desktopFile] = l
+	cb.endLearning(desktopFile, l, time.Second)
+	assert.Equal(t, int64(3800), cb.cfg.Learned["deepin-music"])
+
+	// 用户设置优先于学习到的时间
+	assert.Nil(t, cb.setOverride("deepin-music", 0))
+	_, ok = cb.getSeconds("deepin-music", defaults)
+	assert.False(t, ok)
+	assert.NotNil(t, cb.setOverride("deepin-music", 100))
+	assert.Nil(t, cb.setOverride("deepin-music", -1))
+	seconds, _ = cb.getSeconds("deepin-music", defaults)
+	assert.Equal(t, int32(4), seconds)
+
+	data, err := cb.dump(defaults)
+	assert.Nil(t, err)
+	var table cpuBoostTable
+	assert.Nil(t, json.Unmarshal(data, &table))
+	assert.True(t, table.Enabled)
+	assert.Equal(t, int32(4), table.Apps["deepin-music"].Effective)
+	assert.Equal(t, int32(3), table.Apps["deepin-draw"].Effective)
+
+	assert.Nil(t, cb.resetLearned(""))
+	seconds, _ = cb.getSeconds("deepin-music", defaults)
+	assert.Equal(t, int32(3), seconds)
+
+	// 用户直接编辑文件后重新加载
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"Enabled": false}`), 0644))
+	_, ok = cb.getSeconds("deepin-draw", defaults)
+	assert.False(t, ok)
+
+	cb = newCpuBoostManager(file, nil)
+	assert.False(t, cb.cfg.Enabled)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/memchecker"
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+const (
+	launchMethodExec           = "exec"
+	launchMethodDBusActivation = "dbus-activation"
+
+	cgroupMethodNone         = "none"
+	cgroupMethodSystemdScope = "systemd-scope"
+	cgroupMethodCgexec       = "cgexec"
+	cgroupMethodDE           = "de"
+
+	// 启动时才分配的 cgroup、FIFO 和启动通知 id 在 ExplainLaunch 中的占位符
+	explainNextAvailable = "<next available>"
+)
+
+// LaunchExplanation 描述 launch 启动应用时将执行的命令，由 ExplainLaunch 返回
+type LaunchExplanation struct {
+	DesktopFile     string
+	Action          string `json:",omitempty"`
+	AppId           string
+	Method          string // exec 或 dbus-activation，D-Bus 激活失败时回退到 exec
+	SingleInstance  bool   // 已有实例运行时只激活已有实例
+	RunningInstance bool   // 单实例应用已有 startdde 启动的实例在运行
+	Exec            string
+	Files           []string `json:",omitempty"`
+	CmdPrefixes     []string
+	CmdSuffixes     []string
+	Env             map[string]string `json:",omitempty"` // 命令前缀中添加的环境变量，URL 中的密码已隐藏
+	Terminal        []string          `json:",omitempty"`
+	StartupNotify   bool              // 启动时会设置 DESKTOP_STARTUP_ID
+	CGroupMethod    string
+	CGroup          string                       `json:",omitempty"` // 每次启动分配的 cgroup 为 <next available>
+	Limits          *swapsched.AppResourcesLimit `json:",omitempty"`
+	RestartPolicy   string                       `json:",omitempty"`
+	OutputCapture   string                       `json:",omitempty"` // 输出的捕获方式，见 app_log.go
+	CpuBoost        launchCpuBoost
+	Memory          launchMemoryCheck
+	Error           string `json:",omitempty"` // 启动会失败的原因
+}
+
+type launchCpuBoost struct {
+	Seconds int32
+	Reason  string `json:",omitempty"` // 不锁定 CPU 频率的原因
+}
+
+type launchMemoryCheck struct {
+	Enabled      bool
+	Sufficient   bool
+	NeededMemory uint64 // KB，内存不足时需要释放的内存
+}
+
+// getEnvFromCmdPrefixes 从 /usr/bin/env 命令前缀中取出设置的环境变量
+func getEnvFromCmdPrefixes(prefixes []string) map[string]string {
+	env := make(map[string]string)
+	for i := 0; i < len(prefixes); i++ {
+		if prefixes[i] != "/usr/bin/env" {
+			continue
+		}
+		for i+1 < len(prefixes) {
+			arg := prefixes[i+1]
+			if arg == "-u" && i+2 < len(prefixes) {
+				i += 2
+				continue
+			}
+			kv := strings.SplitN(arg, "=", 2)
+			if len(kv) != 2 || strings.HasPrefix(arg, "-") {
+				break
+			}
+			env[kv[0]] = kv[1]
+			i++
+		}
+	}
+	return env
+}
+
+func getLaunchMemoryCheck(name string) launchMemoryCheck {
+	var ret launchMemoryCheck
+	if _gSettingsConfig == nil || !_gSettingsConfig.memcheckerEnabled {
+		ret.Sufficient = true
+		return ret
+	}
+	ret.Enabled = true
+	ret.Sufficient = memchecker.IsSufficient()
+	if !ret.Sufficient {
+		ret.NeededMemory = getNeededMemory(name)
+	}
+	return ret
+}
+
+// explainLaunch 使用与 launch 相同的启动决策计算启动参数，不会启动应用，也不会创建 cgroup 或写入代理配置
+func (m *StartManager) explainLaunch(desktopFile, action string, files []string) (*LaunchExplanation, error) {
+	appInfo, err := newDesktopAppInfoFromFile(desktopFile)
+	if err != nil {
+		return nil, err
+	}
+	desktopFile = appInfo.GetFileName()
+
+	ex := &LaunchExplanation{
+		DesktopFile: desktopFile,
+		Action:      action,
+		Exec:        appInfo.GetCommandline(),
+		Files:       files,
+	}
+	if action != "" {
+		var found bool
+		for _, a := range appInfo.GetActions() {
+			if a.Section == action {
+				ex.Exec = a.Exec
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("not found section %q in %q", action, desktopFile)
+		}
+	}
+
+	plan := m.newLaunchPlan(appInfo, action, nil, true)
+	ex.AppId = plan.appId
+	ex.Method = plan.method
+	ex.SingleInstance = plan.singleInstance
+	if plan.singleInstance && m.journal != nil {
+		ex.RunningInstance = len(m.getRunningPids(desktopFile)) > 0
+	}
+	ex.RestartPolicy = plan.restartPolicy
+	ex.Terminal = plan.terminal
+	if plan.err != nil {
+		ex.Error = plan.err.Error()
+	}
+	ex.Memory = getLaunchMemoryCheck(desktopFile + action)
+	ex.CpuBoost.Seconds, err = m.getCpuBoostTime(desktopFile)
+	if err != nil {
+		ex.CpuBoost.Reason = err.Error()
+	}
+
+	// cgroup、FIFO 和启动通知 id 在启动时才分配，用占位符表示
+	var controllers string
+	ex.CGroupMethod = plan.cgroupMethod
+	switch plan.cgroupMethod {
+	case cgroupMethodSystemdScope:
+		ex.CGroup = explainNextAvailable
+		ex.Limits = plan.limit
+	case cgroupMethodDE:
+		ex.CGroup = swapSchedDispatcher.GetDECGroup()
+		controllers = "memory"
+	case cgroupMethodCgexec:
+		ex.CGroup = explainNextAvailable
+		ex.Limits = plan.limit
+		controllers = swapSchedDispatcher.AppCGroupControllers()
+	}
+
+	var outputPrefix []string
+	if m.appLog != nil {
+		ex.OutputCapture = m.appLog.mode
+		if m.appLog.mode != appLogModeNone {
+			outputPrefix = (&appOutputCapture{fifo: explainNextAvailable}).getCmdPrefix()
+		}
+	}
+
+	var startupId string
+	if plan.startupNotify {
+		ex.StartupNotify = true
+		startupId = explainNextAvailable
+	}
+
+	cmdPrefixes, cmdSuffixes := plan.getCmdArgs(ex.CGroup, controllers, outputPrefix, startupId)
+	ex.CmdPrefixes = redactCommand(cmdPrefixes)
+	ex.CmdSuffixes = redactCommand(cmdSuffixes)
+	env := getEnvFromCmdPrefixes(ex.CmdPrefixes)
+	if len(env) > 0 {
+		ex.Env = env
+	}
+	return ex, nil
+}
+
+// ExplainLaunch 以 JSON 格式返回启动应用时将执行的命令和相关设置，不会启动应用
+func (m *StartManager) ExplainLaunch(desktopFile, action string, files []string) (string, *dbus.Error) {
+	ex, err := m.explainLaunch(desktopFile, action, files)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := json.Marshal(ex)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getEnvFromCmdPrefixes(t *testing.T) {
+	prefixes := []string{
+		"/usr/bin/cgexec", "-g", "memory:uiapps/3",
+		"/usr/bin/env", "QT_SCALE_FACTOR=1.25", "GDK_SCALE=1",
+		"/usr/bin/env", "-u", "http_proxy", "A=b=c",
+		"/usr/bin/env", "DESKTOP_STARTUP_ID=x",
+		"deepin-terminal", "-e",
+	}
+	assert.Equal(t, map[string]string{
+		"QT_SCALE_FACTOR":    "1.25",
+		"GDK_SCALE":          "1",
+		"A":                  "b=c",
+		"DESKTOP_STARTUP_ID": "x",
+	}, getEnvFromCmdPrefixes(prefixes))
+
+	assert.Empty(t, getEnvFromCmdPrefixes([]string{"/usr/bin/proxychains4", "-f", "a.conf"}))
+}
+
+func TestStartManager_explainLaunch(t *testing.T) {
+	m := &StartManager{}
+	desktopFile := "testdata/desktop/dde-file-manager.desktop"
+
+	ex, err := m.explainLaunch(desktopFile, "", nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "/usr/bin/dde-file-manager -n %u", ex.Exec)
+		assert.Equal(t, launchMethodExec, ex.Method)
+		assert.Equal(t, cgroupMethodNone, ex.CGroupMethod)
+		assert.Empty(t, ex.CmdPrefixes)
+		assert.NotEmpty(t, ex.CpuBoost.Reason)
+		assert.True(t, ex.Memory.Sufficient)
+	}
+
+	ex, err = m.explainLaunch(desktopFile, "new-window", []string{"/tmp"})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "dde-file-manager --new-window", ex.Exec)
+		assert.Equal(t, []string{"/tmp"}, ex.Files)
+	}
+
+	_, err = m.explainLaunch(desktopFile, "not-exist", nil)
+	assert.NotNil(t, err)
+}
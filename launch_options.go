@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/strv"
+)
+
+// LaunchAppWithOptions 和 RunCommandWithOptions 支持的选项:
+//
+//	env          a{ss} 合并到子进程环境变量中
+//	unset-env    as    从子进程环境变量中删除
+//	dir          s     子进程的工作目录
+//	path         s     同 dir，已废弃
+//	cmd-prefix   as    追加到命令前缀之后，位于程序之前
+//	cmd-suffix   as    追加到命令参数之后
+//	stdout       s     以追加方式把标准输出重定向到此文件，必须是绝对路径
+//	stderr       s     以追加方式把标准错误重定向到此文件，必须是绝对路径
+//	auto-restart s     进程异常退出后自动重启，值为 on-failure 或 on-signal，见 restart_policy.go
+const (
+	launchOptionEnv         = "env"
+	launchOptionUnsetEnv    = "unset-env"
+	launchOptionDir         = "dir"
+	launchOptionPath        = "path"
+	launchOptionCmdPrefix   = "cmd-prefix"
+	launchOptionCmdSuffix   = "cmd-suffix"
+	launchOptionStdout      = "stdout"
+	launchOptionStderr      = "stderr"
+	launchOptionAutoRestart = "auto-restart"
+)
+
+type launchOptions struct {
+	env       map[string]string
+	unsetEnv  []string
+	dir       string
+	cmdPrefix []string
+	cmdSuffix []string
+	stdout    string
+	stderr    string
+
+	autoRestart string
+}
+
+func parseLaunchOptions(options map[string]dbus.Variant) (*launchOptions, error) {
+	opts := &launchOptions{}
+	for key, variant := range options {
+		var ok bool
+		switch key {
+		case launchOptionEnv:
+			opts.env, ok = variant.Value().(map[string]string)
+			if ok {
+				for name := range opts.env {
+					if !isValidEnvName(name) {
+						return nil, fmt.Errorf("invalid env name %q", name)
+					}
+				}
+			}
+		case launchOptionUnsetEnv:
+			opts.unsetEnv, ok = variant.Value().([]string)
+		case launchOptionDir, launchOptionPath:
+			opts.dir, ok = variant.Value().(string)
+		case launchOptionCmdPrefix:
+			opts.cmdPrefix, ok = variant.Value().([]string)
+		case launchOptionCmdSuffix:
+			opts.cmdSuffix, ok = variant.Value().([]string)
+		case launchOptionStdout:
+			opts.stdout, ok = variant.Value().(string)
+			if ok && !filepath.IsAbs(opts.stdout) {
+				return nil, fmt.Errorf("option %s is not an absolute path", key)
+			}
+		case launchOptionStderr:
+			opts.stderr, ok = variant.Value().(string)
+			if ok && !filepath.IsAbs(opts.stderr) {
+				return nil, fmt.Errorf("option %s is not an absolute path", key)
+			}
+		case launchOptionAutoRestart:
+			opts.autoRestart, ok = variant.Value().(string)
+			if ok && !isValidRestartPolicy(opts.autoRestart) {
+				return nil, fmt.Errorf("invalid value %q of option %s", opts.autoRestart, key)
+			}
+		default:
+			logger.Debugf("ignore unknown launch option %q", key)
+			ok = true
+		}
+		if !ok {
+			return nil, fmt.Errorf("type of option %s is %s, unexpected", key,
+				variant.Signature())
+		}
+	}
+	return opts, nil
+}
+
+// isEmpty 返回是否没有设置任何选项
+func (opts *launchOptions) isEmpty() bool {
+	return len(opts.env) == 0 && len(opts.unsetEnv) == 0 && opts.dir == "" &&
+		len(opts.cmdPrefix) == 0 && len(opts.cmdSuffix) == 0 &&
+		opts.stdout == "" && opts.stderr == "" && opts.autoRestart == ""
+}
+
+// toMap 返回已设置的选项，键为选项名，用于传给 hook
+func (opts *launchOptions) toMap() map[string]interface{} {
+	ret := make(map[string]interface{})
+	if len(opts.env) > 0 {
+		ret[launchOptionEnv] = opts.env
+	}
+	if len(opts.unsetEnv) > 0 {
+		ret[launchOptionUnsetEnv] = opts.unsetEnv
+	}
+	if opts.dir != "" {
+		ret[launchOptionDir] = opts.dir
+	}
+	if len(opts.cmdPrefix) > 0 {
+		ret[launchOptionCmdPrefix] = opts.cmdPrefix
+	}
+	if len(opts.cmdSuffix) > 0 {
+		ret[launchOptionCmdSuffix] = opts.cmdSuffix
+	}
+	if opts.stdout != "" {
+		ret[launchOptionStdout] = opts.stdout
+	}
+	if opts.stderr != "" {
+		ret[launchOptionStderr] = opts.stderr
+	}
+	if opts.autoRestart != "" {
+		ret[launchOptionAutoRestart] = opts.autoRestart
+	}
+	return ret
+}
+
+func isValidEnvName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "=\x00")
+}
+
+// getEnvPrefix 返回用 /usr/bin/env 设置环境变量的命令前缀，用于无法直接设置 exec.Cmd 的情况
+func (opts *launchOptions) getEnvPrefix() []string {
+	if len(opts.env) == 0 && len(opts.unsetEnv) == 0 {
+		return nil
+	}
+	prefix := []string{"/usr/bin/env"}
+	for _, name := range opts.unsetEnv {
+		prefix = append(prefix, "-u", name)
+	}
+	names := make([]string, 0, len(opts.env))
+	for name := range opts.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prefix = append(prefix, name+"="+opts.env[name])
+	}
+	return prefix
+}
+
+// getRedirectPrefix 返回把输出重定向到文件的命令前缀，用于无法直接设置 exec.Cmd 的情况
+func (opts *launchOptions) getRedirectPrefix() []string {
+	if opts.stdout == "" && opts.stderr == "" {
+		return nil
+	}
+	script := `exec "$@"`
+	if opts.stdout != "" {
+		script += " >>" + shellQuote(opts.stdout)
+	}
+	if opts.stderr != "" {
+		script += " 2>>" + shellQuote(opts.stderr)
+	}
+	return []string{"/bin/sh", "-c", script, "sh"}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func mergeEnv(environ []string, env map[string]string, unsetEnv []string) []string {
+	ret := make([]string, 0, len(environ)+len(env))
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if _, ok := env[name]; ok {
+			continue
+		}
+		if strv.Strv(unsetEnv).Contains(name) {
+			continue
+		}
+		ret = append(ret, kv)
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ret = append(ret, name+"="+env[name])
+	}
+	return ret
+}
+
+// applyToCmd 在 cmd 启动前设置环境变量、工作目录和输出重定向，返回的文件需要在 cmd 启动后关闭
+func (opts *launchOptions) applyToCmd(cmd *exec.Cmd) ([]*os.File, error) {
+	if len(opts.env) > 0 || len(opts.unsetEnv) > 0 {
+		environ := cmd.Env
+		if environ == nil {
+			environ = os.Environ()
+		}
+		cmd.Env = mergeEnv(environ, opts.env, opts.unsetEnv)
+	}
+	if opts.dir != "" {
+		cmd.Dir = opts.dir
+	}
+
+	var files []*os.File
+	if opts.stdout != "" {
+		f, err := openOutputFile(opts.stdout)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		cmd.Stdout = f
+	}
+	if opts.stderr != "" {
+		if opts.stderr == opts.stdout {
+			cmd.Stderr = cmd.Stdout
+		} else {
+			f, err := openOutputFile(opts.stderr)
+			if err != nil {
+				closeFiles(files)
+				return nil, err
+			}
+			files = append(files, f)
+			cmd.Stderr = f
+		}
+	}
+	return files, nil
+}
+
+func openOutputFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		err := f.Close()
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLaunchOptions(t *testing.T) {
+	opts, err := parseLaunchOptions(map[string]dbus.Variant{
+		"env":        dbus.MakeVariant(map[string]string{"QT_DEBUG_PLUGINS": "1"}),
+		"unset-env":  dbus.MakeVariant([]string{"LD_PRELOAD"}),
+		"dir":        dbus.MakeVariant("/tmp"),
+		"cmd-prefix": dbus.MakeVariant([]string{"nice"}),
+		"cmd-suffix": dbus.MakeVariant([]string{"--verbose"}),
+		"stdout":     dbus.MakeVariant("/tmp/out.log"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"QT_DEBUG_PLUGINS": "1"}, opts.env)
+	assert.Equal(t, []string{"LD_PRELOAD"}, opts.unsetEnv)
+	assert.Equal(t, "/tmp", opts.dir)
+	assert.Equal(t, []string{"nice"}, opts.cmdPrefix)
+	assert.Equal(t, []string{"--verbose"}, opts.cmdSuffix)
+	assert.Equal(t, "/tmp/out.log", opts.stdout)
+
+	assert.False(t, opts.isEmpty())
+
+	opts, err = parseLaunchOptions(nil)
+	assert.Nil(t, err)
+	assert.True(t, opts.isEmpty())
+	assert.Nil(t, opts.getEnvPrefix())
+	assert.Nil(t, opts.getRedirectPrefix())
+
+	_, err = parseLaunchOptions(map[string]dbus.Variant{"dir": dbus.MakeVariant(1)})
+	assert.NotNil(t, err)
+	_, err = parseLaunchOptions(map[string]dbus.Variant{"stderr": dbus.MakeVariant("err.log")})
+	assert.NotNil(t, err)
+	_, err = parseLaunchOptions(map[string]dbus.Variant{
+		"env": dbus.MakeVariant(map[string]string{"A=B": "1"})})
+	assert.NotNil(t, err)
+
+	opts, err = parseLaunchOptions(map[string]dbus.Variant{"auto-restart": dbus.MakeVariant("on-signal")})
+	assert.Nil(t, err)
+	assert.Equal(t, restartPolicyOnSignal, opts.autoRestart)
+	assert.False(t, opts.isEmpty())
+	_, err = parseLaunchOptions(map[string]dbus.Variant{"auto-restart": dbus.MakeVariant("always")})
+	assert.NotNil(t, err)
+}
+
+func TestLaunchOptionsPrefix(t *testing.T) {
+	opts := &launchOptions{
+		env:      map[string]string{"B": "2", "A": "1"},
+		unsetEnv: []string{"C"},
+		stdout:   "/tmp/it's.log",
+	}
+	assert.Equal(t, []string{"/usr/bin/env", "-u", "C", "A=1", "B=2"}, opts.getEnvPrefix())
+	assert.Equal(t, []string{"/bin/sh", "-c", `exec "$@" >>'/tmp/it'\''s.log'`, "sh"},
+		opts.getRedirectPrefix())
+}
+
+func TestMergeEnv(t *testing.T) {
+	env := mergeEnv([]string{"A=0", "B=1", "C=2"}, map[string]string{"A": "1"}, []string{"C"})
+	assert.Equal(t, []string{"B=1", "A=1"}, env)
+}
+
+func TestLaunchOptionsApplyToCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-launch-options")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out.log")
+	opts := &launchOptions{
+		env:    map[string]string{"STARTDDE_TEST": "hello"},
+		dir:    dir,
+		stdout: out,
+		stderr: out,
+	}
+	cmd := exec.Command("sh", "-c", `echo $STARTDDE_TEST; pwd; echo err >&2`)
+	files, err := opts.applyToCmd(cmd)
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	closeFiles(files)
+	assert.Nil(t, cmd.Wait())
+
+	content, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\n"+dir+"\nerr\n", string(content))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+// launchPlan 是 launch 和 explainLaunch 共用的启动决策，
+// 创建时不会创建 cgroup、FIFO 和启动通知，这些在启动时才分配，dryRun 时也不会写入代理配置文件
+type launchPlan struct {
+	desktopFile    string
+	appId          string // getAppIdByFilePath 返回的 id，可能为空
+	id             string // 用于 scope 单元名、日志和预加载的 id
+	method         string // exec 或 dbus-activation，由 launchApp 决定，launch 总是 exec
+	singleInstance bool
+	opts           *launchOptions
+	restartPolicy  string
+	limit          *swapsched.AppResourcesLimit
+	cgroupMethod   string
+	terminal       []string
+	appPrefixes    []string // 代理和缩放设置的命令前缀
+	appSuffixes    []string
+	startupNotify  bool
+	err            error // 启动会失败的原因
+}
+
+// getLaunchMethod 返回 launchApp 启动应用的方式，有启动选项时不能通过 D-Bus 激活
+func getLaunchMethod(appInfo *desktopappinfo.DesktopAppInfo, opts *launchOptions) string {
+	if isDBusActivatable(appInfo) && (opts == nil || opts.isEmpty()) {
+		return launchMethodDBusActivation
+	}
+	return launchMethodExec
+}
+
+func (m *StartManager) newLaunchPlan(appInfo *desktopappinfo.DesktopAppInfo, action string,
+	opts *launchOptions, dryRun bool) *launchPlan {
+
+	desktopFile := appInfo.GetFileName()
+	appId := m.getAppIdByFilePath(desktopFile)
+	p := &launchPlan{
+		desktopFile:    desktopFile,
+		appId:          appId,
+		id:             getScopeId(appId, desktopFile),
+		method:         getLaunchMethod(appInfo, opts),
+		singleInstance: action == "" && isSingleInstance(appInfo),
+		opts:           opts,
+		restartPolicy:  getAppRestartPolicy(appInfo),
+		limit:          getAppResourcesLimit(appInfo, loadAppResourcesLimitConfig(appResourcesLimitConfigFile)),
+		cgroupMethod:   cgroupMethodNone,
+	}
+	if opts != nil && opts.autoRestart != "" {
+		p.restartPolicy = opts.autoRestart
+	}
+
+	if needTerminal(appInfo) {
+		p.terminal, p.err = getTerminalCmdPrefix()
+	}
+
+	if useSystemdScope() {
+		p.cgroupMethod = cgroupMethodSystemdScope
+		if isDEComponent(appInfo) {
+			p.limit = nil
+		}
+	} else if swapSchedDispatcher != nil {
+		if isDEComponent(appInfo) {
+			p.cgroupMethod = cgroupMethodDE
+		} else {
+			p.cgroupMethod = cgroupMethodCgexec
+		}
+	}
+
+	if appId != "" {
+		p.appPrefixes, p.appSuffixes = m.getAppCmdArgs(appId, appInfo, dryRun)
+	}
+
+	if m.startupNotifier != nil && m.startupNotifier.xConn != nil {
+		p.startupNotify, _ = needStartupNotify(appInfo)
+	}
+	return p
+}
+
+// getCmdArgs 按启动时的顺序组合命令前缀和后缀，
+// cgroup 为空表示不加入 cgroup，startupId 为空表示不设置 DESKTOP_STARTUP_ID
+func (p *launchPlan) getCmdArgs(cgroup, controllers string, outputPrefix []string,
+	startupId string) (prefixes, suffixes []string) {
+
+	if cgroup != "" {
+		switch p.cgroupMethod {
+		case cgroupMethodSystemdScope:
+			prefixes = getScopeWaitPrefix(cgroup)
+		case cgroupMethodDE, cgroupMethodCgexec:
+			prefixes = getCgroupCmdPrefix(controllers, cgroup)
+		}
+	}
+	prefixes = append(prefixes, p.appPrefixes...)
+	suffixes = append(suffixes, p.appSuffixes...)
+
+	// 放在选项的重定向之前，选项中指定的输出不会被捕获
+	prefixes = append(prefixes, outputPrefix...)
+	if startupId != "" {
+		prefixes = append(prefixes, "/usr/bin/env", "DESKTOP_STARTUP_ID="+startupId)
+	}
+	prefixes = append(prefixes, p.terminal...)
+	// 选项作用于应用，放在终端之后，由终端运行
+	if p.opts != nil {
+		prefixes = append(prefixes, p.opts.getRedirectPrefix()...)
+		prefixes = append(prefixes, p.opts.getEnvPrefix()...)
+		prefixes = append(prefixes, p.opts.cmdPrefix...)
+		suffixes = append(suffixes, p.opts.cmdSuffix...)
+	}
+	return
+}
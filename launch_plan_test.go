@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaunchPlanGetCmdArgs(t *testing.T) {
+	plan := &launchPlan{
+		cgroupMethod: cgroupMethodSystemdScope,
+		appPrefixes:  []string{"/usr/bin/env", "QT_SCALE_FACTOR=1.25"},
+		appSuffixes:  []string{"--force-device-scale-factor=1.25"},
+		terminal:     []string{"deepin-terminal", "-e"},
+		opts: &launchOptions{
+			env:       map[string]string{"A": "1"},
+			cmdPrefix: []string{"nice"},
+			cmdSuffix: []string{"--verbose"},
+		},
+	}
+	output := []string{"/bin/sh", "-c", `exec "$@" >>'/run/fifo' 2>&1`, "sh"}
+
+	prefixes, suffixes := plan.getCmdArgs("app-dde-a-1.scope", "", output, "id-1")
+	expected := getScopeWaitPrefix("app-dde-a-1.scope")
+	expected = append(expected, "/usr/bin/env", "QT_SCALE_FACTOR=1.25")
+	expected = append(expected, output...)
+	expected = append(expected, "/usr/bin/env", "DESKTOP_STARTUP_ID=id-1",
+		"deepin-terminal", "-e", "/usr/bin/env", "A=1", "nice")
+	assert.Equal(t, expected, prefixes)
+	assert.Equal(t, []string{"--force-device-scale-factor=1.25", "--verbose"}, suffixes)
+
+	// 没有 cgroup、输出捕获和启动通知
+	plan = &launchPlan{cgroupMethod: cgroupMethodSystemdScope}
+	prefixes, suffixes = plan.getCmdArgs("", "", nil, "")
+	assert.Empty(t, prefixes)
+	assert.Empty(t, suffixes)
+}
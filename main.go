@@ -106,10 +106,20 @@ func launchCoreComponents(sm *SessionManager) {
 	const waitDelayDuration = 7 * time.Second
 
 	var wg sync.WaitGroup
-	launch := func(program string, args []string, name string, wait bool, endFn func()) {
+	// after 是需要等待其启动完成的组件名，用于启动时间线
+	launch := func(program string, args []string, name string, wait bool, after string, endFn func()) {
+		if after != "" {
+			after = "core/" + after
+		}
+		span := _bootTimeline.begin(bootCategoryCore, "core/"+name, name, bootPhaseCoreComponents, after)
 		if wait {
 			wg.Add(1)
 			sm.launchWaitCore(name, program, args, waitDelayDuration, func(launchOk bool) {
+				if launchOk {
+					span.end("ok")
+				} else {
+					span.end("failed")
+				}
 				if endFn != nil {
 					endFn()
 				}
@@ -119,9 +129,11 @@ func launchCoreComponents(sm *SessionManager) {
 		}
 
 		sm.launchWithoutWait(program, args...)
+		span.end("no-wait")
 	}
 
 	coreStartTime := time.Now()
+	phase := _bootTimeline.begin(bootCategoryPhase, bootPhaseCoreComponents, "core-components", "", "")
 	// launch window manager
 	if !_useWayland {
 		_useKWin = shouldUseDDEKWin()
@@ -129,7 +141,7 @@ func launchCoreComponents(sm *SessionManager) {
 			if wmChooserLaunched {
 				wm_kwin.SyncWmChooserChoice()
 			}
-			launch(cmdKWin, nil, "kwin", true, func() {
+			launch(cmdKWin, nil, "kwin", true, "", func() {
 				// 等待 kwin 就绪，然后让 dock 显示
 				handleKWinReady(sm)
 			})
@@ -139,21 +151,22 @@ func launchCoreComponents(sm *SessionManager) {
 			if wmCmd == "" {
 				wmCmd = "x-window-manager"
 			}
-			launch("env", []string{"GDK_SCALE=1", wmCmd}, "wm", false, nil)
+			launch("env", []string{"GDK_SCALE=1", wmCmd}, "wm", false, "", nil)
 		}
 	}
 
 	// 先启动 dde-session-daemon，再启动 dde-dock
-	launch(cmdDdeSessionDaemon, nil, "dde-session-daemon", true, func() {
+	launch(cmdDdeSessionDaemon, nil, "dde-session-daemon", true, "", func() {
 		var dockArgs []string
 		if _useKWin {
 			dockArgs = []string{"-r"}
 		}
-		launch(cmdDdeDock, dockArgs, "dde-dock", true, nil)
+		launch(cmdDdeDock, dockArgs, "dde-dock", true, "dde-session-daemon", nil)
 	})
-	launch(cmdDdeDesktop, nil, "dde-desktop", true, nil)
+	launch(cmdDdeDesktop, nil, "dde-desktop", true, "", nil)
 
 	wg.Wait()
+	phase.end("")
 	logger.Info("core components cost:", time.Since(coreStartTime))
 }
 
@@ -193,15 +206,18 @@ var _mainBeginTime time.Time
 func logDebugAfter(msg string) {
 	elapsed := time.Since(_mainBeginTime)
 	logger.Debugf("after %s, %s", elapsed, msg)
+	_bootTimeline.mark(msg)
 }
 
 func logInfoAfter(msg string) {
 	elapsed := time.Since(_mainBeginTime)
 	logger.Infof("after %s, %s", elapsed, msg)
+	_bootTimeline.mark(msg)
 }
 
 func main() {
 	_mainBeginTime = time.Now()
+	_bootTimeline = newBootTimeline(_mainBeginTime)
 	flag.Parse()
 	reapZombies()
 	// init x conn
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/swapsched"
 )
 
 const (
@@ -46,7 +47,7 @@ func getProcessList(pid uint16) ([]uint16, error) {
 }
 
 func getPidsInCGroup(cgroupName string) ([]uint16, error) {
-	cgroupProcsFile := filepath.Join("/sys/fs/cgroup/memory", cgroupName, "cgroup.procs")
+	cgroupProcsFile := filepath.Join(getCGroupMemoryDir(cgroupName), "cgroup.procs")
 	contents, err := ioutil.ReadFile(cgroupProcsFile)
 	if err != nil {
 		return nil, err
@@ -97,7 +98,41 @@ func getCGroupDDEPath() (string, error) {
 		return "", err
 	}
 
-	return fmt.Sprintf("/sys/fs/cgroup/memory/%s@dde/uiapps/", id), nil
+	return getCGroupMemoryDir(id+"@dde/uiapps") + "/", nil
+}
+
+// getCGroupMemoryDir 返回 cgroup 在 memory 层级中的目录，cgroup v2 中所有控制器共用一个层级
+func getCGroupMemoryDir(cgroupName string) string {
+	if swapsched.IsUnifiedCgroup() {
+		return filepath.Join(swapsched.SystemCGroupRoot, cgroupName)
+	}
+	return filepath.Join(swapsched.SystemCGroupRoot, "memory", cgroupName)
+}
+
+// getCGroupV2Memory 从 memory.stat 读取匿名页和页表的用量，单位为 kB，与 sumMemByFile 一致
+func getCGroupV2Memory(cgroupName string) (uint64, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(getCGroupMemoryDir(cgroupName), "memory.stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	var memSize uint64
+	lines := strings.Split(string(contents), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[0] != "anon" && fields[0] != "pagetables" {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		memSize += v
+	}
+	return memSize / 1024, nil
 }
 
 func getSessionID() (string, error) {
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"pkg.deepin.io/dde/startdde/swapsched"
 	"pkg.deepin.io/lib/strv"
 )
 
@@ -21,6 +22,9 @@ func GetProcessMemory(name string) (uint64, error) {
 
 // GetCGroupMemory get these process in cgroup used memory
 func GetCGroupMemory(cgroupName string) (uint64, error) {
+	if swapsched.IsUnifiedCgroup() {
+		return getCGroupV2Memory(cgroupName)
+	}
 	list, err := getPidsInCGroup(cgroupName)
 	if err != nil {
 		return 0, err
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/keyfile"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const (
+	mimeAppsListFile  = "mimeapps.list"
+	mimeInfoCacheFile = "mimeinfo.cache"
+
+	sectionDefaultApplications = "Default Applications"
+	sectionAddedAssociations   = "Added Associations"
+	sectionRemovedAssociations = "Removed Associations"
+	sectionMIMECache           = "MIME Cache"
+
+	mimeTypeDirectory   = "inode/directory"
+	mimeTypeTextPlain   = "text/plain"
+	schemeHandlerPrefix = "x-scheme-handler/"
+
+	// 内容检测读取的字节数，与 GIO 查询文件类型时读取的一致
+	mimeSniffLen = 4096
+)
+
+// getMimeAppsListFiles 按优先级从高到低返回 mimeapps.list 文件，
+// 每个目录中桌面环境专用的 $desktop-mimeapps.list 优先于 mimeapps.list
+func getMimeAppsListFiles(desktops []string) []string {
+	var dirs []string
+	dirs = append(dirs, basedir.GetUserConfigDir())
+	dirs = append(dirs, basedir.GetSystemConfigDirs()...)
+	dirs = append(dirs, filepath.Join(basedir.GetUserDataDir(), AppDirName))
+	for _, dir := range basedir.GetSystemDataDirs() {
+		dirs = append(dirs, filepath.Join(dir, AppDirName))
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		for _, desktop := range desktops {
+			files = append(files, filepath.Join(dir, desktop+"-"+mimeAppsListFile))
+		}
+		files = append(files, filepath.Join(dir, mimeAppsListFile))
+	}
+	return files
+}
+
+func getMimeInfoCacheFiles() []string {
+	var files []string
+	files = append(files, filepath.Join(basedir.GetUserDataDir(), AppDirName, mimeInfoCacheFile))
+	for _, dir := range basedir.GetSystemDataDirs() {
+		files = append(files, filepath.Join(dir, AppDirName, mimeInfoCacheFile))
+	}
+	return files
+}
+
+func getCurrentDesktops() []string {
+	var desktops []string
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if desktop != "" {
+			desktops = append(desktops, strings.ToLower(desktop))
+		}
+	}
+	return desktops
+}
+
+// mimeAppsResolver 按照 XDG MIME Applications Associations 规范查找 MIME 类型的默认应用
+type mimeAppsResolver struct {
+	listFiles   []string
+	cacheFiles  []string
+	isInstalled func(id string) bool
+}
+
+func newMimeAppsResolver() *mimeAppsResolver {
+	return &mimeAppsResolver{
+		listFiles:  getMimeAppsListFiles(getCurrentDesktops()),
+		cacheFiles: getMimeInfoCacheFiles(),
+		isInstalled: func(id string) bool {
+			return desktopappinfo.NewDesktopAppInfo(id) != nil
+		},
+	}
+}
+
+func getDesktopIdList(kf *keyfile.KeyFile, section, mimeType string) []string {
+	value, _ := kf.GetString(section, mimeType)
+	var ids []string
+	for _, id := range strings.Split(value, ";") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// getDefaultApp 返回 mimeType 的默认应用的 desktop id，没有找到时返回空
+func (r *mimeAppsResolver) getDefaultApp(mimeType string) string {
+	var kfs []*keyfile.KeyFile
+	for _, file := range r.listFiles {
+		kf := keyfile.NewKeyFile()
+		if kf.LoadFromFile(file) == nil {
+			kfs = append(kfs, kf)
+		}
+	}
+
+	// 优先级高的文件中删除的关联对优先级低的文件也有效
+	removed := make(map[string]bool)
+	var added []string
+	for _, kf := range kfs {
+		for _, id := range getDesktopIdList(kf, sectionDefaultApplications, mimeType) {
+			if !removed[id] && r.isInstalled(id) {
+				return id
+			}
+		}
+		for _, id := range getDesktopIdList(kf, sectionAddedAssociations, mimeType) {
+			if !removed[id] {
+				added = append(added, id)
+			}
+		}
+		for _, id := range getDesktopIdList(kf, sectionRemovedAssociations, mimeType) {
+			removed[id] = true
+		}
+	}
+
+	for _, id := range added {
+		if r.isInstalled(id) {
+			return id
+		}
+	}
+
+	for _, file := range r.cacheFiles {
+		kf := keyfile.NewKeyFile()
+		if kf.LoadFromFile(file) != nil {
+			continue
+		}
+		for _, id := range getDesktopIdList(kf, sectionMIMECache, mimeType) {
+			if !removed[id] && r.isInstalled(id) {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// getMimeTypeCandidates 返回查找默认应用时依次尝试的 MIME 类型，
+// 没有专门处理的文本类型使用 text/plain 的默认应用
+func getMimeTypeCandidates(mimeType string) []string {
+	candidates := []string{mimeType}
+	if strings.HasPrefix(mimeType, "text/") && mimeType != mimeTypeTextPlain {
+		candidates = append(candidates, mimeTypeTextPlain)
+	}
+	return candidates
+}
+
+// getFileMimeType 根据文件名和文件内容判断文件的 MIME 类型
+func getFileMimeType(filename string) (string, error) {
+	fileInfo, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+	if fileInfo.IsDir() {
+		return mimeTypeDirectory, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, mimeSniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return guessContentType(filename, buf[:n]), nil
+}
+
+// getURIMimeType 返回 uri 对应的 MIME 类型，本地文件检测文件类型，其他 uri 使用 x-scheme-handler/<scheme>
+func getURIMimeType(uri string) (string, error) {
+	// 绝对路径不是 uri，其中的 % 等字符不能按 uri 解析
+	if filepath.IsAbs(uri) {
+		return getFileMimeType(uri)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "":
+		// 相对路径是相对于调用者的工作目录的，startdde 无法得知
+		return "", fmt.Errorf("%q is not an absolute path", uri)
+	case "file":
+		return getFileMimeType(u.Path)
+	}
+	return schemeHandlerPrefix + strings.ToLower(u.Scheme), nil
+}
+
+// supportsMultipleFiles 返回 Exec 是否可以一次接受多个文件或 uri
+func supportsMultipleFiles(exec string) bool {
+	return strings.Contains(exec, "%F") || strings.Contains(exec, "%U")
+}
+
+type uriGroup struct {
+	desktopFile string
+	uris        []string
+}
+
+// groupURIsByHandler 按默认应用对 uri 分组，保持 uri 的顺序，返回无法处理的 uri 的错误
+func groupURIsByHandler(uris []string, getHandler func(uri string) (string, error)) ([]*uriGroup, []error) {
+	var groups []*uriGroup
+	var errs []error
+	groupMap := make(map[string]*uriGroup)
+	for _, uri := range uris {
+		desktopFile, err := getHandler(uri)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", uri, err))
+			continue
+		}
+		group, ok := groupMap[desktopFile]
+		if !ok {
+			group = &uriGroup{desktopFile: desktopFile}
+			groupMap[desktopFile] = group
+			groups = append(groups, group)
+		}
+		group.uris = append(group.uris, uri)
+	}
+	return groups, errs
+}
+
+func getURIHandler(r *mimeAppsResolver, uri string) (string, error) {
+	mimeType, err := getURIMimeType(uri)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range getMimeTypeCandidates(mimeType) {
+		id := r.getDefaultApp(candidate)
+		if id == "" {
+			continue
+		}
+		appInfo := desktopappinfo.NewDesktopAppInfo(id)
+		if appInfo != nil {
+			return appInfo.GetFileName(), nil
+		}
+	}
+	return "", fmt.Errorf("no default application for %s", mimeType)
+}
+
+func (m *StartManager) openURIs(uris []string, timestamp uint32) error {
+	r := newMimeAppsResolver()
+	groups, errs := groupURIsByHandler(uris, func(uri string) (string, error) {
+		return getURIHandler(r, uri)
+	})
+
+	for _, group := range groups {
+		logger.Debugf("open %v with %s", group.uris, group.desktopFile)
+		batches := [][]string{group.uris}
+		appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile(group.desktopFile)
+		if err == nil && !supportsMultipleFiles(appInfo.GetCommandline()) {
+			batches = batches[:0]
+			for _, uri := range group.uris {
+				batches = append(batches, []string{uri})
+			}
+		}
+		for _, files := range batches {
+			err := m.launchAppWithOptions(group.desktopFile, timestamp, files, nil)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", group.desktopFile, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		var msgs []string
+		for _, err := range errs {
+			logger.Warning(err)
+			msgs = append(msgs, err.Error())
+		}
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// OpenURIs 用 MIME 类型对应的默认应用打开文件或 uri，同一个应用的 uri 一起打开
+func (m *StartManager) OpenURIs(sender dbus.Sender, uris []string, timestamp uint32) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.openURIs(uris, timestamp)
+	return dbusutil.ToError(err)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMimeAppsResolver() *mimeAppsResolver {
+	installed := map[string]bool{
+		"browser.desktop":          true,
+		"firefox.desktop":          true,
+		"mail.desktop":             true,
+		"gedit.desktop":            true,
+		"editor.desktop":           true,
+		"viewer.desktop":           true,
+		"reader.desktop":           true,
+		"dde-file-manager.desktop": true,
+		"gimp.desktop":             true,
+	}
+	return &mimeAppsResolver{
+		listFiles: []string{
+			"testdata/mimeapps/user/deepin-mimeapps.list",
+			"testdata/mimeapps/user/mimeapps.list",
+			"testdata/mimeapps/system/deepin-mimeapps.list",
+			"testdata/mimeapps/system/mimeapps.list",
+		},
+		cacheFiles: []string{
+			"testdata/mimeapps/system/mimeinfo.cache",
+		},
+		isInstalled: func(id string) bool {
+			return installed[id]
+		},
+	}
+}
+
+func Test_mimeAppsResolver_getDefaultApp(t *testing.T) {
+	r := newTestMimeAppsResolver()
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		// 桌面环境专用的文件优先，跳过没有安装的应用
+		{"text/html", "browser.desktop"},
+		{"x-scheme-handler/mailto", "mail.desktop"},
+		// 用户删除的关联对系统配置也有效
+		{"text/plain", "editor.desktop"},
+		// 默认应用优先于添加的关联
+		{"image/png", "gimp.desktop"},
+		{"application/pdf", "reader.desktop"},
+		{"application/zip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.getDefaultApp(tt.mimeType))
+		})
+	}
+
+	r.isInstalled = func(id string) bool {
+		return id == "viewer.desktop"
+	}
+	assert.Equal(t, "viewer.desktop", r.getDefaultApp("image/png"))
+}
+
+func Test_getMimeTypeCandidates(t *testing.T) {
+	assert.Equal(t, []string{"text/x-python", "text/plain"}, getMimeTypeCandidates("text/x-python"))
+	assert.Equal(t, []string{"text/plain"}, getMimeTypeCandidates("text/plain"))
+	assert.Equal(t, []string{"image/png"}, getMimeTypeCandidates("image/png"))
+}
+
+func Test_getURIMimeType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-open-uri")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	noExt := filepath.Join(dir, "README")
+	assert.Nil(t, ioutil.WriteFile(noExt, []byte("hello world\n"), 0644))
+	png := filepath.Join(dir, "a.png")
+	assert.Nil(t, ioutil.WriteFile(png, []byte{}, 0644))
+	percent := filepath.Join(dir, "100%.png")
+	assert.Nil(t, ioutil.WriteFile(percent, []byte{}, 0644))
+	script := filepath.Join(dir, "run")
+	assert.Nil(t, ioutil.WriteFile(script, []byte("#!/bin/sh\necho hello\n"), 0755))
+
+	tests := []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{uri: "https://www.deepin.org", want: "x-scheme-handler/https"},
+		{uri: "MAILTO:someone@deepin.org", want: "x-scheme-handler/mailto"},
+		{uri: dir, want: mimeTypeDirectory},
+		{uri: "file://" + noExt, want: "text/plain"},
+		{uri: png, want: "image/png"},
+		{uri: percent, want: "image/png"},
+		{uri: script, want: "application/x-shellscript"},
+		{uri: "a.png", wantErr: true},
+		{uri: filepath.Join(dir, "notexist"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			got, err := getURIMimeType(tt.uri)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_groupURIsByHandler(t *testing.T) {
+	handlers := map[string]string{
+		"a.txt":  "editor.desktop",
+		"b.html": "browser.desktop",
+		"c.txt":  "editor.desktop",
+	}
+	groups, errs := groupURIsByHandler([]string{"a.txt", "b.html", "c.txt", "d.zip"},
+		func(uri string) (string, error) {
+			if h, ok := handlers[uri]; ok {
+				return h, nil
+			}
+			return "", errors.New("no default application")
+		})
+	assert.Len(t, errs, 1)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "editor.desktop", groups[0].desktopFile)
+		assert.Equal(t, []string{"a.txt", "c.txt"}, groups[0].uris)
+		assert.Equal(t, "browser.desktop", groups[1].desktopFile)
+		assert.Equal(t, []string{"b.html"}, groups[1].uris)
+	}
+}
+
+func Test_supportsMultipleFiles(t *testing.T) {
+	assert.True(t, supportsMultipleFiles("gedit %U"))
+	assert.True(t, supportsMultipleFiles("eog %F"))
+	assert.False(t, supportsMultipleFiles("firefox %u"))
+	assert.False(t, supportsMultipleFiles("dde-calendar"))
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+	"pkg.deepin.io/lib/strv"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+// 代理注入方式
+const (
+	proxyMethodAuto        = ""
+	proxyMethodProxyChains = "proxychains"
+	proxyMethodProxyServer = "proxy-server"
+	proxyMethodEnv         = "env"
+	proxyMethodSelf        = "self"
+)
+
+// desktop 文件中声明代理注入方式的键，例如
+//
+//	X-Deepin-ProxyArgument=--proxy-server=%p
+//	X-Deepin-ProxyMode=env|proxychains|self
+const (
+	KeyXDeepinProxyArgument = "X-Deepin-ProxyArgument"
+	KeyXDeepinProxyMode     = "X-Deepin-ProxyMode"
+)
+
+type appProxyMetadata struct {
+	mode     string
+	argument string
+}
+
+func getAppProxyMetadata(appInfo *desktopappinfo.DesktopAppInfo) *appProxyMetadata {
+	meta := &appProxyMetadata{}
+	meta.argument, _ = appInfo.GetString(desktopappinfo.MainSection, KeyXDeepinProxyArgument)
+	mode, _ := appInfo.GetString(desktopappinfo.MainSection, KeyXDeepinProxyMode)
+	switch mode {
+	case "", proxyMethodEnv, proxyMethodProxyChains, proxyMethodSelf:
+		meta.mode = mode
+	default:
+		logger.Warningf("invalid %s %q in %s", KeyXDeepinProxyMode, mode, appInfo.GetFileName())
+	}
+	return meta
+}
+
+var proxyTypes = []string{"http", "https", "socks4", "socks5"}
+
+// ProxyProfile 是一个命名的代理配置
+type ProxyProfile struct {
+	Type     string
+	Host     string
+	Port     uint32
+	User     string
+	Password string
+	Bypass   []string // 不使用代理的地址，可以是域名、IP 或 CIDR
+}
+
+// ProxyAppSetting 指定应用使用的代理配置和注入方式
+type ProxyAppSetting struct {
+	Profile string
+	Method  string
+}
+
+type proxyProfilesConfig struct {
+	Profiles map[string]*ProxyProfile
+	Apps     map[string]*ProxyAppSetting
+}
+
+type proxyProfileManager struct {
+	mu   sync.Mutex
+	file string
+	cfg  proxyProfilesConfig
+}
+
+func getProxyProfilesFile() string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "proxy-profiles.json")
+}
+
+func newProxyProfileManager(file string) *proxyProfileManager {
+	pm := &proxyProfileManager{file: file}
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, &pm.cfg)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load proxy profiles:", err)
+	}
+	if pm.cfg.Profiles == nil {
+		pm.cfg.Profiles = make(map[string]*ProxyProfile)
+	}
+	if pm.cfg.Apps == nil {
+		pm.cfg.Apps = make(map[string]*ProxyAppSetting)
+	}
+	return pm
+}
+
+// save 需要在持有 pm.mu 的情况下调用，文件中含有密码，只允许用户自己读写
+func (pm *proxyProfileManager) save() error {
+	data, err := json.MarshalIndent(pm.cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(pm.file), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pm.file, data, 0600)
+}
+
+func (p *ProxyProfile) check() error {
+	if !strv.Strv(proxyTypes).Contains(p.Type) {
+		return fmt.Errorf("invalid proxy type %q", p.Type)
+	}
+	if p.Host == "" {
+		return errors.New("proxy host is empty")
+	}
+	if p.Port == 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid proxy port %d", p.Port)
+	}
+	// 代理配置写入 proxychains 配置和环境变量文件，每行一项
+	if strings.ContainsAny(p.Host+p.User+p.Password, " \t\r\n") {
+		return errors.New("proxy host, user and password should not contain spaces")
+	}
+	for _, bypass := range p.Bypass {
+		if bypass == "" || strings.ContainsAny(bypass, " \t\r\n,;") {
+			return fmt.Errorf("invalid bypass %q", bypass)
+		}
+	}
+	return nil
+}
+
+func isValidProxyMethod(method string) bool {
+	switch method {
+	case proxyMethodAuto, proxyMethodProxyChains, proxyMethodProxyServer, proxyMethodEnv:
+		return true
+	}
+	return false
+}
+
+func (pm *proxyProfileManager) setProfile(name string, profile *ProxyProfile) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	err := profile.check()
+	if err != nil {
+		return err
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.cfg.Profiles[name] = profile
+	return pm.save()
+}
+
+// removeProfile 删除代理配置，同时删除使用它的应用设置
+func (pm *proxyProfileManager) removeProfile(name string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if _, ok := pm.cfg.Profiles[name]; !ok {
+		return fmt.Errorf("proxy profile %q not found", name)
+	}
+	delete(pm.cfg.Profiles, name)
+	for appId, setting := range pm.cfg.Apps {
+		if setting.Profile == name {
+			delete(pm.cfg.Apps, appId)
+		}
+	}
+	return pm.save()
+}
+
+// setApp 设置应用使用的代理配置，profile 为空表示取消
+func (pm *proxyProfileManager) setApp(appId, profile, method string) error {
+	if appId == "" {
+		return errors.New("app id is empty")
+	}
+	if !isValidProxyMethod(method) {
+		return fmt.Errorf("invalid proxy method %q", method)
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if profile == "" {
+		delete(pm.cfg.Apps, appId)
+	} else {
+		if _, ok := pm.cfg.Profiles[profile]; !ok {
+			return fmt.Errorf("proxy profile %q not found", profile)
+		}
+		pm.cfg.Apps[appId] = &ProxyAppSetting{Profile: profile, Method: method}
+	}
+	return pm.save()
+}
+
+// getApp 返回应用使用的代理配置的副本和注入方式，没有设置时返回 nil
+func (pm *proxyProfileManager) getApp(appId string) (string, *ProxyProfile, string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	setting, ok := pm.cfg.Apps[appId]
+	if !ok {
+		return "", nil, ""
+	}
+	profile, ok := pm.cfg.Profiles[setting.Profile]
+	if !ok {
+		return "", nil, ""
+	}
+	profileCopy := *profile
+	return setting.Profile, &profileCopy, setting.Method
+}
+
+// dump 返回所有代理配置和应用设置，不包含密码
+func (pm *proxyProfileManager) dump() ([]byte, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	cfg := proxyProfilesConfig{
+		Profiles: make(map[string]*ProxyProfile, len(pm.cfg.Profiles)),
+		Apps:     pm.cfg.Apps,
+	}
+	for name, profile := range pm.cfg.Profiles {
+		profileCopy := *profile
+		profileCopy.Password = ""
+		cfg.Profiles[name] = &profileCopy
+	}
+	return json.Marshal(cfg)
+}
+
+// url 返回代理地址，withAuth 为 true 时包含用户名和密码
+func (p *ProxyProfile) url(withAuth bool) string {
+	u := url.URL{
+		Scheme: p.Type,
+		Host:   net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))),
+	}
+	if withAuth && p.User != "" {
+		u.User = url.UserPassword(p.User, p.Password)
+	}
+	return u.String()
+}
+
+// getEnv 返回设置代理的环境变量
+func (p *ProxyProfile) getEnv() []string {
+	proxyUrl := p.url(true)
+	var env []string
+	for _, name := range []string{"http_proxy", "https_proxy", "all_proxy"} {
+		env = append(env, name+"="+proxyUrl, strings.ToUpper(name)+"="+proxyUrl)
+	}
+	if len(p.Bypass) > 0 {
+		noProxy := strings.Join(p.Bypass, ",")
+		env = append(env, "no_proxy="+noProxy, "NO_PROXY="+noProxy)
+	}
+	return env
+}
+
+// getProxyServerArgs 按模板生成代理参数，模板中的 %p 替换为代理地址，这种方式不支持认证，
+// 模板为空时使用 chromium 系浏览器的参数
+func (p *ProxyProfile) getProxyServerArgs(template string) []string {
+	if template == "" {
+		args := []string{"--proxy-server=" + p.url(false)}
+		if len(p.Bypass) > 0 {
+			args = append(args, "--proxy-bypass-list="+strings.Join(p.Bypass, ";"))
+		}
+		return args
+	}
+
+	var args []string
+	for _, field := range strings.Fields(template) {
+		field = strings.Replace(field, "%p", p.url(false), -1)
+		args = append(args, strings.Replace(field, "%%", "%", -1))
+	}
+	return args
+}
+
+// getProxyChainsConfig 生成 proxychains4 的配置，proxychains 只接受 IP 地址，主机名需要先解析
+func (p *ProxyProfile) getProxyChainsConfig(lookupHost func(string) ([]string, error)) (string, error) {
+	proxyType := p.Type
+	switch proxyType {
+	case "socks4", "socks5", "http":
+	default:
+		return "", fmt.Errorf("proxy type %q is not supported by proxychains", proxyType)
+	}
+
+	host := p.Host
+	if net.ParseIP(host) == nil {
+		addrs, err := lookupHost(host)
+		if err != nil {
+			return "", err
+		}
+		if len(addrs) == 0 {
+			return "", fmt.Errorf("failed to resolve %s", host)
+		}
+		host = addrs[0]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("strict_chain\nquiet_mode\nproxy_dns\n")
+	buf.WriteString("tcp_read_time_out 15000\ntcp_connect_time_out 8000\n")
+	for _, bypass := range p.Bypass {
+		localnet := getProxyChainsLocalnet(bypass)
+		if localnet == "" {
+			logger.Debugf("proxychains: ignore bypass %q", bypass)
+			continue
+		}
+		buf.WriteString("localnet " + localnet + "\n")
+	}
+	buf.WriteString("[ProxyList]\n")
+	fmt.Fprintf(&buf, "%s %s %d", proxyType, host, p.Port)
+	if p.User != "" {
+		fmt.Fprintf(&buf, " %s %s", p.User, p.Password)
+	}
+	buf.WriteString("\n")
+	return buf.String(), nil
+}
+
+// getProxyChainsLocalnet 把 IP 或 CIDR 转换为 proxychains localnet 的 地址/掩码 格式，不支持域名
+func getProxyChainsLocalnet(bypass string) string {
+	if !strings.Contains(bypass, "/") {
+		ip := net.ParseIP(bypass).To4()
+		if ip == nil {
+			return ""
+		}
+		return ip.String() + "/255.255.255.255"
+	}
+	_, ipNet, err := net.ParseCIDR(bypass)
+	if err != nil || ipNet.IP.To4() == nil {
+		return ""
+	}
+	return ipNet.IP.String() + "/" + net.IP(ipNet.Mask).String()
+}
+
+func getProxyChainsConfigFile(profileName string) string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde",
+		"proxychains-"+profileName+".conf")
+}
+
+func writeProxyChainsConfig(profileName string, profile *ProxyProfile) (string, error) {
+	content, err := profile.getProxyChainsConfig(net.LookupHost)
+	if err != nil {
+		return "", err
+	}
+	file := getProxyChainsConfigFile(profileName)
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return "", err
+	}
+	return file, ioutil.WriteFile(file, []byte(content), 0600)
+}
+
+func getProxyEnvFile(profileName string) string {
+	name := "proxy.env"
+	if profileName != "" {
+		name = "proxy-" + profileName + ".env"
+	}
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", name)
+}
+
+// writeProxyEnvFile 把代理环境变量写入只有用户自己可以读的文件，代理的用户名和密码不会出现在命令行中
+func writeProxyEnvFile(profileName string, profile *ProxyProfile) (string, error) {
+	file := getProxyEnvFile(profileName)
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return "", err
+	}
+	content := strings.Join(profile.getEnv(), "\n") + "\n"
+	return file, ioutil.WriteFile(file, []byte(content), 0600)
+}
+
+// getEnvFileCmdPrefix 返回从文件读取环境变量后再运行命令的命令前缀，文件每行是一个 name=value
+func getEnvFileCmdPrefix(file string) []string {
+	script := `while IFS= read -r kv; do export "$kv"; done <` + shellQuote(file) + `; exec "$@"`
+	return []string{"/bin/sh", "-c", script, "sh"}
+}
+
+// getProxyChainsBin 返回 proxychains 程序的路径，启动时没有找到则再查找一次
+func (m *StartManager) getProxyChainsBin() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.proxyChainsBin == "" {
+		m.proxyChainsBin, _ = exec.LookPath(proxychainsBinary)
+	}
+	return m.proxyChainsBin
+}
+
+// getProxyCmdArgs 返回使用代理配置启动应用需要的命令前缀和后缀，
+// argTemplate 是 desktop 文件中的 X-Deepin-ProxyArgument，chainsConfFile 不为空时直接使用该 proxychains 配置，
+// dryRun 时只返回配置文件的路径，不写入文件
+func (m *StartManager) getProxyCmdArgs(profileName string, profile *ProxyProfile, method,
+	argTemplate, chainsConfFile string, dryRun bool) (prefixes, suffixes []string, err error) {
+
+	logger.Debugf("launch: use proxy profile %q, method %q", profileName, method)
+
+	switch method {
+	case proxyMethodSelf:
+		// 应用自己处理代理
+	case proxyMethodProxyServer:
+		suffixes = profile.getProxyServerArgs(argTemplate)
+	case proxyMethodEnv:
+		envFile := getProxyEnvFile(profileName)
+		if !dryRun {
+			envFile, err = writeProxyEnvFile(profileName, profile)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		prefixes = getEnvFileCmdPrefix(envFile)
+	case proxyMethodProxyChains:
+		proxyChainsBin := m.getProxyChainsBin()
+		if proxyChainsBin == "" {
+			return nil, nil, errors.New("proxychains not found")
+		}
+		if chainsConfFile == "" && dryRun {
+			chainsConfFile = getProxyChainsConfigFile(profileName)
+		} else if chainsConfFile == "" {
+			chainsConfFile, err = writeProxyChainsConfig(profileName, profile)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		prefixes = []string{proxyChainsBin, "-f", chainsConfFile}
+	default:
+		return nil, nil, fmt.Errorf("invalid proxy method %q", method)
+	}
+	return
+}
+
+// resolveProxyMethod 决定应用的代理注入方式，
+// 声明 X-Deepin-ProxyMode=self 的应用总是自己处理代理，其次使用用户设置的方式，然后是 desktop 文件声明的方式
+func (m *StartManager) resolveProxyMethod(appId string, meta *appProxyMetadata, method string) string {
+	if meta.mode == proxyMethodSelf {
+		return proxyMethodSelf
+	}
+	if method != proxyMethodAuto {
+		return method
+	}
+	if meta.argument != "" {
+		return proxyMethodProxyServer
+	}
+	if meta.mode != "" {
+		return meta.mode
+	}
+
+	// 兼容没有声明代理元数据的 desktop 文件
+	if ignoreUseProxy(appId) {
+		return proxyMethodSelf
+	}
+	if supportProxyServerOption(appId) {
+		return proxyMethodProxyServer
+	}
+	if m.getProxyChainsBin() != "" {
+		return proxyMethodProxyChains
+	}
+	return proxyMethodEnv
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"strings"
@@ -33,15 +32,23 @@ func loadProxyChainsConfig(file string) (*ProxyChainsConfig, error) {
 	return &cfg, nil
 }
 
-func getProxyServerUrl() (string, error) {
+// loadLegacyProxyProfile 把 dde-daemon 写入的全局代理配置转换为代理配置
+func loadLegacyProxyProfile() (*ProxyProfile, error) {
 	file := filepath.Join(basedir.GetUserConfigDir(), "deepin/proxychains.json")
 	cfg, err := loadProxyChainsConfig(file)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return fmt.Sprintf("%s://%s:%d", cfg.Type, cfg.IP, cfg.Port), nil
+	return &ProxyProfile{
+		Type:     cfg.Type,
+		Host:     cfg.IP,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+	}, nil
 }
 
+// supportProxyServerOption 用于兼容没有声明 X-Deepin-ProxyArgument 的浏览器
 func supportProxyServerOption(appId string) bool {
 	return strings.HasPrefix(appId, "google-chrome") ||
 		strings.HasPrefix(appId, "browser360") ||
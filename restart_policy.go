@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+const (
+	KeyXDeepinAutoRestartPolicy = "X-Deepin-AutoRestart-Policy"
+
+	// 非 0 退出或被信号终止时重启，X-GNOME-AutoRestart=true 默认使用此策略
+	restartPolicyOnFailure = "on-failure"
+	// 只在被信号终止(崩溃)时重启，正常退出和以非 0 值退出都不重启
+	restartPolicyOnSignal = "on-signal"
+
+	restartBackoffInitial = time.Second
+	restartBackoffMax     = time.Minute
+	// 在 restartWindow 时间内最多重启 restartMaxAttempts 次，超过后放弃
+	restartWindow      = 5 * time.Minute
+	restartMaxAttempts = 5
+
+	signalAppRestartGaveUp = "AppRestartGaveUp"
+)
+
+func isValidRestartPolicy(policy string) bool {
+	return policy == restartPolicyOnFailure || policy == restartPolicyOnSignal
+}
+
+// getAppRestartPolicy 返回 desktop 文件中声明的重启策略，不需要重启时返回空
+func getAppRestartPolicy(appInfo *desktopappinfo.DesktopAppInfo) string {
+	autoRestart, _ := appInfo.GetBool(desktopappinfo.MainSection, KeyXGnomeAutoRestart)
+	if !autoRestart {
+		return ""
+	}
+	policy, _ := appInfo.GetString(desktopappinfo.MainSection, KeyXDeepinAutoRestartPolicy)
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if policy == "" {
+		return restartPolicyOnFailure
+	}
+	if !isValidRestartPolicy(policy) {
+		logger.Warningf("%s: invalid %s %q", appInfo.GetFileName(), KeyXDeepinAutoRestartPolicy, policy)
+		return restartPolicyOnFailure
+	}
+	return policy
+}
+
+// isIntentionalSignal 返回信号是否通常由用户或会话主动发送，这类终止不算崩溃
+func isIntentionalSignal(sig int) bool {
+	switch syscall.Signal(sig) {
+	case syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP:
+		return true
+	}
+	return false
+}
+
+func shouldRestart(policy string, exitCode, signal int) bool {
+	switch policy {
+	case restartPolicyOnFailure:
+		return exitCode != 0 || signal != 0
+	case restartPolicyOnSignal:
+		return signal != 0 && !isIntentionalSignal(signal)
+	}
+	return false
+}
+
+// restartTracker 记录应用最近的重启时间，用于计算退避时间和限制重启次数
+type restartTracker struct {
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+}
+
+func newRestartTracker() *restartTracker {
+	return &restartTracker{
+		attempts: make(map[string][]time.Time),
+	}
+}
+
+// next 记录一次重启并返回重启前需要等待的时间，
+// 在 restartWindow 内已经重启了 restartMaxAttempts 次时 ok 为 false
+func (t *restartTracker) next(key string, now time.Time) (delay time.Duration, attempts int, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var recent []time.Time
+	for _, at := range t.attempts[key] {
+		if now.Sub(at) < restartWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= restartMaxAttempts {
+		t.attempts[key] = recent
+		return 0, len(recent), false
+	}
+
+	delay = restartBackoffInitial << uint(len(recent))
+	if delay > restartBackoffMax {
+		delay = restartBackoffMax
+	}
+	t.attempts[key] = append(recent, now)
+	return delay, len(recent) + 1, true
+}
+
+// restartApp 按重启策略在退避时间后重新启动已退出的应用
+func (m *StartManager) restartApp(app *launchedApp, rec *AppLaunchRecord) {
+	if !shouldRestart(app.restartPolicy, rec.ExitCode, rec.Signal) {
+		return
+	}
+
+	name := rec.name()
+	delay, attempts, ok := m.restartTracker.next(name, time.Now())
+	if !ok {
+		logger.Warningf("app %q restarted %d times within %v, give up", name, attempts, restartWindow)
+		m.emitSignalAppRestartGaveUp(name, attempts)
+		return
+	}
+
+	logger.Infof("restart app %q in %v, attempt %d", name, delay, attempts)
+	time.AfterFunc(delay, func() {
+		var err error
+		if app.appInfo != nil {
+			err = m.launch(app.appInfo, 0, nil, app.appInfo, app.appInfo.GetFileName(), app.opts, true)
+		} else {
+			err = m.runCommand(app.exe, app.args, app.opts, true)
+		}
+		if err != nil {
+			logger.Warningf("failed to restart app %q: %v", name, err)
+		}
+	})
+}
+
+func (m *StartManager) emitSignalAppRestartGaveUp(name string, attempts int) {
+	err := m.service.Emit(m, signalAppRestartGaveUp, name, uint32(attempts))
+	if err != nil {
+		logger.Warning("failed to emit signal AppRestartGaveUp:", err)
+	}
+}
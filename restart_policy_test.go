@@ -0,0 +1,52 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRestart(t *testing.T) {
+	assert.True(t, shouldRestart(restartPolicyOnFailure, 1, 0))
+	assert.True(t, shouldRestart(restartPolicyOnFailure, -1, int(syscall.SIGTERM)))
+	assert.False(t, shouldRestart(restartPolicyOnFailure, 0, 0))
+
+	assert.True(t, shouldRestart(restartPolicyOnSignal, -1, int(syscall.SIGSEGV)))
+	assert.True(t, shouldRestart(restartPolicyOnSignal, -1, int(syscall.SIGABRT)))
+	assert.False(t, shouldRestart(restartPolicyOnSignal, -1, int(syscall.SIGTERM)))
+	assert.False(t, shouldRestart(restartPolicyOnSignal, 1, 0))
+
+	assert.False(t, shouldRestart("", 1, 0))
+}
+
+func TestRestartTracker(t *testing.T) {
+	tracker := newRestartTracker()
+	now := time.Now()
+
+	var delays []time.Duration
+	for i := 0; i < restartMaxAttempts; i++ {
+		delay, attempts, ok := tracker.next("app", now.Add(time.Duration(i)*time.Second))
+		assert.True(t, ok)
+		assert.Equal(t, i+1, attempts)
+		delays = append(delays, delay)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second,
+		8 * time.Second, 16 * time.Second}, delays)
+
+	_, attempts, ok := tracker.next("app", now.Add(time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, restartMaxAttempts, attempts)
+
+	// 其他应用不受影响
+	delay, _, ok := tracker.next("other", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, delay)
+
+	// 时间窗口过去之后重新计数
+	delay, attempts, ok = tracker.next("app", now.Add(restartWindow+time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, time.Second, delay)
+}
@@ -76,6 +76,8 @@ fi
 %{_sysconfdir}/X11/xinit/xinitrc.d/01deepin-profile
 %{_sysconfdir}/profile.d/deepin-xdg-dir.sh
 %{_bindir}/%{name}
+%{_bindir}/%{name}-explain
+%{_bindir}/%{name}-analyze
 %{_sbindir}/deepin-fix-xauthority-perm
 %{_datadir}/xsessions/deepin.desktop
 %{_datadir}/lightdm/lightdm.conf.d/60-deepin.conf
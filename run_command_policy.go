@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/procfs"
+	"pkg.deepin.io/lib/strv"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+// RunCommand 和 RunCommandWithOptions 的策略文件，不存在时不做限制
+const runCommandPolicyFile = "/etc/deepin/startdde/run-command-policy.json"
+
+const (
+	runCommandAuditMaxRecords = 500
+	// 审计日志超过此大小时保存为 .old 文件，重新开始记录
+	runCommandAuditMaxFileSize = 1024 * 1024
+)
+
+// 策略生效时默认拒绝的选项，它们可以通过 PATH、LD_PRELOAD 或包装程序改变实际运行的程序
+var runCommandRestrictedOptions = []string{launchOptionEnv, launchOptionUnsetEnv, launchOptionCmdPrefix}
+
+// runCommandPolicy 中 *-commands 和 *-callers 的每一项都是 filepath.Match 的模式，匹配可执行文件的绝对路径。
+// 先检查 denied-*，匹配则拒绝；allowed-* 不为空时，不匹配其中任何一项也拒绝。
+// allowed-options 列出允许使用的 env、unset-env 和 cmd-prefix 选项。
+type runCommandPolicy struct {
+	AllowedCommands []string `json:"allowed-commands"`
+	DeniedCommands  []string `json:"denied-commands"`
+	AllowedCallers  []string `json:"allowed-callers"`
+	DeniedCallers   []string `json:"denied-callers"`
+	AllowedOptions  []string `json:"allowed-options"`
+}
+
+func loadRunCommandPolicy(filename string) (*runCommandPolicy, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var policy runCommandPolicy
+	err = json.Unmarshal(content, &policy)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func matchAnyPattern(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		ok, err := filepath.Match(pattern, path)
+		if err != nil {
+			logger.Warningf("bad pattern %q: %v", pattern, err)
+			continue
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// check 检查 caller 能否运行 commands 中的程序，commands 包括 cmd-prefix 中的程序
+func (p *runCommandPolicy) check(callerExe string, commands []string) error {
+	if matchAnyPattern(p.DeniedCallers, callerExe) {
+		return fmt.Errorf("caller %q is denied", callerExe)
+	}
+	if len(p.AllowedCallers) > 0 && !matchAnyPattern(p.AllowedCallers, callerExe) {
+		return fmt.Errorf("caller %q is not allowed", callerExe)
+	}
+	for _, command := range commands {
+		if matchAnyPattern(p.DeniedCommands, command) {
+			return fmt.Errorf("command %q is denied", command)
+		}
+		if len(p.AllowedCommands) > 0 && !matchAnyPattern(p.AllowedCommands, command) {
+			return fmt.Errorf("command %q is not allowed", command)
+		}
+	}
+	return nil
+}
+
+// checkOptions 检查请求中的选项是否被策略允许
+func (p *runCommandPolicy) checkOptions(options map[string]dbus.Variant) error {
+	for _, name := range runCommandRestrictedOptions {
+		if _, ok := options[name]; ok && !strv.Strv(p.AllowedOptions).Contains(name) {
+			return fmt.Errorf("option %s is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// lookupCommandPath 返回命令的绝对路径，不解析符号链接，找不到时返回 name
+func lookupCommandPath(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return name
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return name
+	}
+	return path
+}
+
+// resolveCommandPath 返回命令解析符号链接后的绝对路径，用于和策略中的模式匹配
+func resolveCommandPath(name string) string {
+	path := lookupCommandPath(name)
+	if !filepath.IsAbs(path) {
+		return name
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return realPath
+}
+
+// RunCommandAuditRecord 记录一次 RunCommand 请求及其结果
+type RunCommandAuditRecord struct {
+	Time      int64 // unix time in milliseconds
+	CallerPid uint32
+	CallerExe string
+	Command   []string
+	Allowed   bool
+	Reason    string
+}
+
+type runCommandAudit struct {
+	mu      sync.Mutex
+	records []*RunCommandAuditRecord
+	file    string
+}
+
+func getRunCommandAuditFile() string {
+	return filepath.Join(basedir.GetUserCacheDir(), "deepin", "startdde", "run-command-audit.log")
+}
+
+func newRunCommandAudit(file string) *runCommandAudit {
+	if file != "" {
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	return &runCommandAudit{file: file}
+}
+
+func (a *runCommandAudit) add(rec *RunCommandAuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, rec)
+	if len(a.records) > runCommandAuditMaxRecords {
+		a.records = a.records[len(a.records)-runCommandAuditMaxRecords:]
+	}
+
+	if a.file == "" {
+		return
+	}
+	a.rotate()
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	f, err := os.OpenFile(a.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Warning("failed to open run command audit log:", err)
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		logger.Warning("failed to write run command audit log:", err)
+	}
+	err = f.Close()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// rotate 在日志文件过大时把它保存为 .old 文件，需要在持有 a.mu 的情况下调用
+func (a *runCommandAudit) rotate() {
+	fileInfo, err := os.Stat(a.file)
+	if err != nil || fileInfo.Size() < runCommandAuditMaxFileSize {
+		return
+	}
+	err = os.Rename(a.file, a.file+".old")
+	if err != nil {
+		logger.Warning("failed to rotate run command audit log:", err)
+	}
+}
+
+// dump 返回 since(unix 毫秒时间)之后的记录，since 为 0 则返回全部
+func (a *runCommandAudit) dump(since int64) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	records := make([]*RunCommandAuditRecord, 0, len(a.records))
+	for _, rec := range a.records {
+		if rec.Time >= since {
+			records = append(records, rec)
+		}
+	}
+	return json.Marshal(records)
+}
+
+func getCallerExe(service *dbusutil.Service, sender dbus.Sender) (uint32, string, error) {
+	pid, err := service.GetConnPID(string(sender))
+	if err != nil {
+		return 0, "", err
+	}
+	exe, err := procfs.Process(pid).Exe()
+	if err != nil {
+		return pid, "", err
+	}
+	return pid, exe, nil
+}
+
+// checkRunCommand 按策略文件检查 RunCommand 请求并记录到审计日志，返回程序的绝对路径，
+// 调用者运行这个路径，PATH 和工作目录不会改变实际运行的程序
+func (m *StartManager) checkRunCommand(sender dbus.Sender, exe string, args []string,
+	options map[string]dbus.Variant) (string, error) {
+
+	exe = lookupCommandPath(exe)
+	rec := &RunCommandAuditRecord{
+		Time:    toMilliseconds(time.Now()),
+		Command: append([]string{exe}, args...),
+	}
+	err := m.doCheckRunCommand(sender, exe, options, rec)
+	if err != nil {
+		rec.Reason = err.Error()
+		logger.Warningf("RunCommand %v from %s(%d) denied: %v", rec.Command, rec.CallerExe,
+			rec.CallerPid, err)
+	} else {
+		rec.Allowed = true
+	}
+	m.runCommandAudit.add(rec)
+	return exe, err
+}
+
+func (m *StartManager) doCheckRunCommand(sender dbus.Sender, exe string,
+	options map[string]dbus.Variant, rec *RunCommandAuditRecord) error {
+
+	var err error
+	rec.CallerPid, rec.CallerExe, err = getCallerExe(m.service, sender)
+	if err != nil {
+		logger.Warning("failed to get caller exe:", err)
+	}
+
+	err = checkDMsgUid(m.service, sender)
+	if err != nil {
+		return err
+	}
+
+	policy, err := loadRunCommandPolicy(runCommandPolicyFile)
+	if err != nil {
+		// 策略文件损坏时拒绝，以免在受限的环境中放开限制
+		return fmt.Errorf("failed to load run command policy: %v", err)
+	}
+	if policy == nil {
+		return nil
+	}
+
+	err = policy.checkOptions(options)
+	if err != nil {
+		return err
+	}
+	opts, err := parseLaunchOptions(options)
+	if err != nil {
+		return err
+	}
+	commands := []string{resolveCommandPath(exe)}
+	if len(opts.cmdPrefix) > 0 {
+		// 与程序一样运行检查过的绝对路径
+		prefix := append([]string{lookupCommandPath(opts.cmdPrefix[0])}, opts.cmdPrefix[1:]...)
+		options[launchOptionCmdPrefix] = dbus.MakeVariant(prefix)
+		commands = append(commands, resolveCommandPath(prefix[0]))
+	}
+	return policy.check(rec.CallerExe, commands)
+}
+
+// GetRunCommandAuditLog 以 JSON 格式返回本次会话中 since(unix 毫秒时间)之后的 RunCommand 请求记录
+func (m *StartManager) GetRunCommandAuditLog(sender dbus.Sender, since int64) (string, *dbus.Error) {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := m.runCommandAudit.dump(since)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
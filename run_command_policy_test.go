@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCommandPolicy(t *testing.T) {
+	policy, err := loadRunCommandPolicy("testdata/run_command_policy/policy.json")
+	assert.Nil(t, err)
+	assert.NotNil(t, policy)
+
+	assert.Nil(t, policy.check("/usr/bin/dde-dock", []string{"/usr/bin/deepin-terminal"}))
+	assert.Nil(t, policy.check("/usr/lib/deepin-daemon/dde-session-daemon",
+		[]string{"/usr/lib/deepin-daemon/dde-osd"}))
+	assert.NotNil(t, policy.check("/usr/bin/dde-untrusted", []string{"/usr/bin/deepin-terminal"}))
+	assert.NotNil(t, policy.check("/usr/bin/python3", []string{"/usr/bin/deepin-terminal"}))
+	assert.NotNil(t, policy.check("", []string{"/usr/bin/deepin-terminal"}))
+	assert.NotNil(t, policy.check("/usr/bin/dde-dock", []string{"/usr/bin/rm"}))
+	assert.NotNil(t, policy.check("/usr/bin/dde-dock", []string{"/opt/evil/run"}))
+	// cmd-prefix 中的程序也要检查
+	assert.NotNil(t, policy.check("/usr/bin/dde-dock", []string{"/usr/bin/deepin-terminal", "/tmp/sh"}))
+
+	policy, err = loadRunCommandPolicy("testdata/run_command_policy/not-exist.json")
+	assert.Nil(t, err)
+	assert.Nil(t, policy)
+
+	policy = &runCommandPolicy{DeniedCommands: []string{"/usr/bin/rm"}}
+	assert.Nil(t, policy.check("/usr/bin/python3", []string{"/usr/bin/ls"}))
+	assert.NotNil(t, policy.check("/usr/bin/python3", []string{"/usr/bin/rm"}))
+}
+
+func TestRunCommandAudit(t *testing.T) {
+	audit := newRunCommandAudit("")
+	audit.add(&RunCommandAuditRecord{Time: 100, CallerExe: "/usr/bin/dde-dock",
+		Command: []string{"ls"}, Allowed: true})
+	audit.add(&RunCommandAuditRecord{Time: 200, CallerExe: "/usr/bin/python3",
+		Command: []string{"rm", "-rf", "/"}, Reason: "denied"})
+
+	data, err := audit.dump(150)
+	assert.Nil(t, err)
+	var records []*RunCommandAuditRecord
+	assert.Nil(t, json.Unmarshal(data, &records))
+	assert.Len(t, records, 1)
+	assert.Equal(t, "/usr/bin/python3", records[0].CallerExe)
+	assert.False(t, records[0].Allowed)
+
+	data, err = audit.dump(0)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(data, &records))
+	assert.Len(t, records, 2)
+}
+
+func TestRunCommandPolicyCheckOptions(t *testing.T) {
+	policy := &runCommandPolicy{}
+	assert.Nil(t, policy.checkOptions(nil))
+	assert.Nil(t, policy.checkOptions(map[string]dbus.Variant{
+		launchOptionDir: dbus.MakeVariant("/tmp"),
+	}))
+	assert.NotNil(t, policy.checkOptions(map[string]dbus.Variant{
+		launchOptionEnv: dbus.MakeVariant(map[string]string{"LD_PRELOAD": "/tmp/evil.so"}),
+	}))
+	assert.NotNil(t, policy.checkOptions(map[string]dbus.Variant{
+		launchOptionCmdPrefix: dbus.MakeVariant([]string{"sh", "-c"}),
+	}))
+
+	policy.AllowedOptions = []string{launchOptionEnv}
+	assert.Nil(t, policy.checkOptions(map[string]dbus.Variant{
+		launchOptionEnv: dbus.MakeVariant(map[string]string{"LANG": "C"}),
+	}))
+	assert.NotNil(t, policy.checkOptions(map[string]dbus.Variant{
+		launchOptionUnsetEnv: dbus.MakeVariant([]string{"PATH"}),
+	}))
+}
+
+func TestLookupCommandPath(t *testing.T) {
+	path := lookupCommandPath("sh")
+	assert.True(t, filepath.IsAbs(path))
+	assert.Equal(t, "not-exist-command", lookupCommandPath("not-exist-command"))
+	assert.Equal(t, "not-exist-command", resolveCommandPath("not-exist-command"))
+}
+
+func TestRunCommandAuditRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "run-command-audit.log")
+	err = ioutil.WriteFile(file, []byte(strings.Repeat("x", runCommandAuditMaxFileSize)), 0600)
+	assert.Nil(t, err)
+
+	audit := newRunCommandAudit(file)
+	audit.add(&RunCommandAuditRecord{Time: 100, Command: []string{"ls"}, Allowed: true})
+	fileInfo, err := os.Stat(file)
+	assert.Nil(t, err)
+	assert.True(t, fileInfo.Size() < 1024)
+	fileInfo, err = os.Stat(file + ".old")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(runCommandAuditMaxFileSize), fileInfo.Size())
+}
@@ -109,6 +109,7 @@ type SessionManager struct {
 		IsInhibited           func() `in:"flags" out:"result"`
 		Uninhibit             func() `in:"cookie"`
 		GetInhibitors         func() `out:"inhibitors"`
+		GetBootTimeline       func() `out:"timeline"`
 	}
 }
 
@@ -123,7 +124,7 @@ const (
 	SessionStageInitBegin int32 = iota
 	SessionStageInitEnd
 	SessionStageCoreBegin
-	SessionStageCoreEnd // nolint
+	SessionStageCoreEnd
 	SessionStageAppsBegin
 	SessionStageAppsEnd
 )
@@ -513,16 +514,22 @@ func (m *SessionManager) initSession() {
 }
 
 func (m *SessionManager) initSwapSched() {
-	err := cgroup.Init()
-	if err != nil {
-		logger.Warning(err)
-		return
-	}
+	var err error
+	if swapsched.IsUnifiedCgroup() {
+		// cgroup v2 不需要 libcgroup 和 cgexec
+		logger.Info("swap sched: use cgroup v2")
+	} else {
+		err = cgroup.Init()
+		if err != nil {
+			logger.Warning(err)
+			return
+		}
 
-	globalCgExecBin, err = exec.LookPath("cgexec")
-	if err != nil {
-		logger.Warning("cgexec not found:", err)
-		return
+		globalCgExecBin, err = exec.LookPath("cgexec")
+		if err != nil {
+			logger.Warning("cgexec not found:", err)
+			return
+		}
 	}
 
 	sessionID, err := m.objLoginSessionSelf.Id().Get(0)
@@ -557,9 +564,7 @@ func (m *SessionManager) initSwapSched() {
 
 	if err == nil {
 		// add self to DE cgroup
-		deCg := cgroup.NewCgroup(swapSchedDispatcher.GetDECGroup())
-		deCg.AddController(cgroup.Memory)
-		err = deCg.AttachCurrentProcess()
+		err = swapSchedDispatcher.AttachCurrentProcessToDE()
 		if err != nil {
 			logger.Warning("failed to add self to DE cgroup:", err)
 		}
@@ -668,6 +673,8 @@ func (m *SessionManager) startWMSwitcher() {
 }
 
 func (m *SessionManager) launchDDE() {
+	phase := _bootTimeline.begin(bootCategoryPhase, bootPhaseLaunchDDE, "launch-dde", "",
+		bootPhaseCoreComponents)
 	versionChanged, err := isDeepinVersionChanged()
 	if err != nil {
 		logger.Warning("failed to get deepin version changed:", err)
@@ -701,41 +708,64 @@ func (m *SessionManager) launchDDE() {
 	groups, err := loadGroupFile()
 	if err != nil {
 		logger.Error("Failed to load launch group file:", err)
+		phase.end("failed")
 		return
 	}
 
 	sort.Sort(groups)
 
+	// 每组在上一组结束后开始
+	after := bootPhaseCoreComponents
 	for idx, group := range groups {
 		logger.Debugf("[%d] group p%d start", idx, group.Priority)
+		groupId := fmt.Sprintf("group/%d", idx)
+		groupSpan := _bootTimeline.begin(bootCategoryGroup, groupId, fmt.Sprintf("group p%d", group.Priority),
+			bootPhaseLaunchDDE, after)
 
 		var waitGroup sync.WaitGroup
 		waitGroup.Add(len(group.Group))
 
-		for _, cmd := range group.Group {
+		for cmdIdx, cmd := range group.Group {
 			cmd := cmd
+			span := _bootTimeline.begin(bootCategoryCommand, fmt.Sprintf("%s/%d", groupId, cmdIdx),
+				cmd.Command, groupId, after)
 			go func() {
 				logger.Debug("run cmd:", cmd.Command, cmd.Args, cmd.Wait)
-				m.launch(cmd.Command, cmd.Wait, cmd.Args...)
+				ok := m.launch(cmd.Command, cmd.Wait, cmd.Args...)
+				switch {
+				case !cmd.Wait:
+					span.end("no-wait")
+				case ok:
+					span.end("ok")
+				default:
+					span.end("failed")
+				}
 				waitGroup.Done()
 			}()
 		}
 
 		waitGroup.Wait()
+		groupSpan.end("")
+		after = groupId
 
 		logger.Debugf("[%d] group p%d end", idx, group.Priority)
 	}
+	phase.end("")
 }
 
 func (m *SessionManager) launchAutostart() {
 	m.setPropStage(SessionStageAppsBegin)
 	delay := _gSettingsConfig.autoStartDelay
 	logger.Debug("autostart delay seconds:", delay)
+	delaySpan := _bootTimeline.begin(bootCategoryPhase, bootPhaseAutostartDelay, "autostart-delay", "",
+		bootPhaseLaunchDDE)
 	if delay > 0 {
 		time.AfterFunc(time.Second*time.Duration(delay), func() {
+			delaySpan.end("")
 			startAutostartProgram()
 		})
 	} else {
+		delaySpan.end("")
 		startAutostartProgram()
 	}
 	m.setPropStage(SessionStageAppsEnd)
@@ -998,6 +1028,7 @@ func (m *SessionManager) start(xConn *x.Conn, sysSignalLoop *dbusutil.SignalLoop
 	}
 	m.setPropStage(SessionStageCoreBegin)
 	startStartManager(xConn, service)
+	_startManager.startAutostartStage(SessionStageCoreBegin)
 
 	m.startWMSwitcher()
 
@@ -1009,6 +1040,8 @@ func (m *SessionManager) start(xConn *x.Conn, sysSignalLoop *dbusutil.SignalLoop
 	// start obex.service
 	go startObexService()
 	m.launchDDE()
+	m.setPropStage(SessionStageCoreEnd)
+	_startManager.startAutostartStage(SessionStageCoreEnd)
 
 	go func() {
 		setLeftPtrCursor()
@@ -1114,13 +1147,17 @@ func isDeepinVersionChanged() (changed bool, err error) {
 }
 
 func setLeftPtrCursor() {
+	setRootCursor("left_ptr")
+}
+
+func setRootCursor(name string) {
 	gs := gio.NewSettings("com.deepin.xsettings")
 	defer gs.Unref()
 
 	theme := gs.GetString("gtk-cursor-theme-name")
 	size := gs.GetInt("gtk-cursor-theme-size")
 
-	err := xcursor.LoadAndApply(theme, "left_ptr", int(size))
+	err := xcursor.LoadAndApply(theme, name, int(size))
 	if err != nil {
 		logger.Warning(err)
 	}
@@ -150,10 +150,9 @@ func (m *SessionManager) launch(bin string, wait bool, args ...string) bool {
 	}
 
 	if swapSchedDispatcher != nil {
-		cgroupPath := swapSchedDispatcher.GetDECGroup()
-		argsTemp := []string{"-g", "memory:" + cgroupPath, bin}
-		args = append(argsTemp, args...)
-		bin = globalCgExecBin
+		prefix := getCgroupCmdPrefix("memory", swapSchedDispatcher.GetDECGroup())
+		args = append(append(prefix[1:], bin), args...)
+		bin = prefix[0]
 	}
 	logger.Debugf("sessionManager.launch %q %v", bin, args)
 
@@ -174,6 +173,10 @@ func (m *SessionManager) Register(id string) (bool, *dbus.Error) {
 
 	timeCh := m.cookies[id]
 	if timeCh == nil {
+		// 自启动应用使用 StartManager 分配的 cookie 注册
+		if _startManager != nil && _startManager.autostartQueue.register(id) {
+			return true, nil
+		}
 		return false, nil
 	}
 	delete(m.cookies, id)
@@ -48,6 +48,7 @@ func (op *SessionManager) setPropName(name string) {
 func (m *SessionManager) setPropStage(v int32) {
 	if m.Stage != v {
 		m.Stage = v
+		_bootTimeline.setStage(v)
 		err := m.service.EmitPropertyChanged(m, "Stage", v)
 		if err != nil {
 			logger.Warning(err)
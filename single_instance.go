@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+const (
+	KeySingleInstance  = "X-Deepin-SingleInstance"
+	KeyStartupWMClass  = "StartupWMClass"
+	KeyDBusActivatable = "DBusActivatable"
+
+	applicationIfc         = "org.freedesktop.Application"
+	applicationCallTimeout = 25 * time.Second
+
+	// _NET_ACTIVE_WINDOW 请求的来源，2 表示来自 pager 等用户直接操作
+	activeWindowSourcePager = 2
+)
+
+func isSingleInstance(appInfo *desktopappinfo.DesktopAppInfo) bool {
+	v, _ := appInfo.GetBool(desktopappinfo.MainSection, KeySingleInstance)
+	return v
+}
+
+func isDBusActivatable(appInfo *desktopappinfo.DesktopAppInfo) bool {
+	v, _ := appInfo.GetBool(desktopappinfo.MainSection, KeyDBusActivatable)
+	return v
+}
+
+// getDBusAppId 返回 desktop 文件对应的 D-Bus 应用 id，即去掉 .desktop 后缀的文件名
+func getDBusAppId(desktopFile string) string {
+	return strings.TrimSuffix(filepath.Base(desktopFile), desktopExt)
+}
+
+// getApplicationObjPath 按 Desktop Entry 规范由应用 id 得到 org.freedesktop.Application 的对象路径
+func getApplicationObjPath(appId string) dbus.ObjectPath {
+	path := "/" + strings.Replace(appId, ".", "/", -1)
+	return dbus.ObjectPath(strings.Replace(path, "-", "_", -1))
+}
+
+// filesToURIs 把本地路径转换为 file:// URI，已经是 URI 的保持不变
+func filesToURIs(files []string) []string {
+	uris := make([]string, 0, len(files))
+	for _, file := range files {
+		if strings.Contains(file, "://") {
+			uris = append(uris, file)
+			continue
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			abs = file
+		}
+		u := url.URL{Scheme: "file", Path: abs}
+		uris = append(uris, u.String())
+	}
+	return uris
+}
+
+// isWindowOfApp 判断窗口是否属于应用，WM_CLASS 的 instance 或 class 与 StartupWMClass 相同，或窗口 pid 属于应用
+func isWindowOfApp(startupWMClass string, pids []int, winClass *icccm.WMClass, winPid int) bool {
+	if startupWMClass != "" && winClass != nil {
+		if strings.EqualFold(winClass.Instance, startupWMClass) ||
+			strings.EqualFold(winClass.Class, startupWMClass) {
+			return true
+		}
+	}
+	if winPid > 0 {
+		for _, pid := range pids {
+			if pid == winPid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *StartManager) getRunningPids(desktopFile string) []int {
+	pids := m.journal.getRunningPids(desktopFile)
+	if swapSchedDispatcher != nil {
+		pids = append(pids, swapSchedDispatcher.GetAppPids(desktopFile)...)
+	}
+	return pids
+}
+
+// findAppWindow 在 _NET_CLIENT_LIST 中查找属于应用的窗口，按堆叠顺序返回最后找到的窗口
+func (m *StartManager) findAppWindow(startupWMClass string, pids []int) (x.Window, error) {
+	if m.xConn == nil {
+		return 0, errors.New("no X connection")
+	}
+	clientList, err := ewmh.GetClientList(m.xConn).Reply(m.xConn)
+	if err != nil {
+		return 0, err
+	}
+
+	var found x.Window
+	for _, win := range clientList {
+		var winClass *icccm.WMClass
+		if startupWMClass != "" {
+			wmClass, err := icccm.GetWMClass(m.xConn, win).Reply(m.xConn)
+			if err == nil {
+				winClass = &wmClass
+			}
+		}
+		var winPid int
+		if len(pids) > 0 {
+			pid, err := ewmh.GetWMPid(m.xConn, win).Reply(m.xConn)
+			if err == nil {
+				winPid = int(pid)
+			}
+		}
+		if isWindowOfApp(startupWMClass, pids, winClass, winPid) {
+			found = win
+		}
+	}
+	return found, nil
+}
+
+// activateWindow 向窗口管理器发送 _NET_ACTIVE_WINDOW 请求激活窗口
+func (m *StartManager) activateWindow(win x.Window, timestamp uint32) error {
+	atomNetActiveWindow, err := m.xConn.GetAtom("_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return err
+	}
+
+	// data 为 source、timestamp 和当前活动窗口
+	data := make([]byte, 20)
+	binary.LittleEndian.PutUint32(data[0:], activeWindowSourcePager)
+	binary.LittleEndian.PutUint32(data[4:], timestamp)
+	ev := makeClientMessageEvent(32, win, atomNetActiveWindow, data)
+
+	root := m.xConn.GetDefaultScreen().Root
+	return x.SendEventChecked(m.xConn, false, root,
+		x.EventMaskSubstructureNotify|x.EventMaskSubstructureRedirect, ev).Check(m.xConn)
+}
+
+// callApplication 调用 DBusActivatable 应用的 org.freedesktop.Application 接口
+func callApplication(desktopFile, method string, args ...interface{}) error {
+	sessionBus, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	appId := getDBusAppId(desktopFile)
+	obj := sessionBus.Object(appId, getApplicationObjPath(appId))
+	// 允许 dbus-daemon 自动启动应用，启动可能较慢
+	ctx, cancel := context.WithTimeout(context.Background(), applicationCallTimeout)
+	defer cancel()
+	return obj.CallWithContext(ctx, applicationIfc+"."+method, 0, args...).Err
+}
+
+// activateRunningInstance 如果单实例应用已经在运行，激活它的窗口并返回 true，
+// DBusActivatable 应用的文件通过 org.freedesktop.Application.Open 传给已运行的实例，
+// 不是 DBusActivatable 的应用无法把文件传给已运行的实例，有文件时返回 false，由正常的启动流程打开文件，
+// 只有找到运行中的实例但激活失败时才返回错误，此时不应再启动新的实例
+func (m *StartManager) activateRunningInstance(appInfo *desktopappinfo.DesktopAppInfo,
+	desktopFile string, timestamp uint32, files []string) (bool, error) {
+
+	if len(files) > 0 && !isDBusActivatable(appInfo) {
+		return false, nil
+	}
+	startupWMClass, _ := appInfo.GetString(desktopappinfo.MainSection, KeyStartupWMClass)
+	pids := m.getRunningPids(desktopFile)
+	if startupWMClass == "" && len(pids) == 0 {
+		return false, nil
+	}
+
+	win, err := m.findAppWindow(startupWMClass, pids)
+	if err != nil {
+		if len(pids) == 0 {
+			logger.Warning("failed to find window of running instance:", err)
+			return false, nil
+		}
+		return false, err
+	}
+	running := win != 0 || len(pids) > 0
+
+	if running && len(files) > 0 && isDBusActivatable(appInfo) {
+		err = callApplication(desktopFile, "Open", filesToURIs(files), map[string]dbus.Variant{})
+		if err != nil {
+			return false, err
+		}
+		logger.Debugf("forward files to running instance of %s", desktopFile)
+		if win == 0 {
+			return true, nil
+		}
+	} else if win == 0 {
+		return false, nil
+	}
+
+	logger.Debugf("activate window %d of running instance of %s", win, desktopFile)
+	return true, m.activateWindow(win, timestamp)
+}
+
+// getDesktopActionName 返回 desktop action 的名称，即去掉 "Desktop Action " 前缀的节名
+func getDesktopActionName(actionSection string) string {
+	return strings.TrimPrefix(actionSection, "Desktop Action ")
+}
+
+// activateDBusApp 通过 org.freedesktop.Application 接口启动 DBusActivatable 应用，
+// action 不为空时调用 ActivateAction，有文件时调用 Open，否则调用 Activate。
+// 应用由 dbus-daemon 启动，不在 startdde 创建的 cgroup 中运行，应用的代理、缩放、资源限制
+// 和输出捕获等设置都不会生效，也不会发送 AppLaunched 信号，只在启动日志中记录
+func (m *StartManager) activateDBusApp(appInfo *desktopappinfo.DesktopAppInfo, desktopFile,
+	action string, timestamp uint32, files []string) error {
+
+	platformData := make(map[string]dbus.Variant)
+	startupSeq := m.startupNotifier.begin(appInfo, timestamp)
+	if startupSeq != nil {
+		platformData["desktop-startup-id"] = dbus.MakeVariant(startupSeq.id)
+	}
+
+	var err error
+	var method string
+	if action != "" {
+		method = "ActivateAction"
+		err = callApplication(desktopFile, method, getDesktopActionName(action),
+			[]dbus.Variant{}, platformData)
+	} else if len(files) > 0 {
+		method = "Open"
+		err = callApplication(desktopFile, method, filesToURIs(files), platformData)
+	} else {
+		method = "Activate"
+		err = callApplication(desktopFile, method, platformData)
+	}
+	if err != nil {
+		if startupSeq != nil {
+			m.startupNotifier.end(startupSeq)
+		}
+		return err
+	}
+	logger.Debugf("activate %s via %s", desktopFile, applicationIfc)
+	m.journal.addActivation(desktopFile, method)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+	"github.com/stretchr/testify/assert"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+func TestGetApplicationObjPath(t *testing.T) {
+	assert.Equal(t, "org.gnome.Nautilus", getDBusAppId("/usr/share/applications/org.gnome.Nautilus.desktop"))
+	assert.Equal(t, dbus.ObjectPath("/org/gnome/Nautilus"), getApplicationObjPath("org.gnome.Nautilus"))
+	assert.Equal(t, dbus.ObjectPath("/com/deepin/foo_bar"), getApplicationObjPath("com.deepin.foo-bar"))
+}
+
+func TestFilesToURIs(t *testing.T) {
+	assert.Equal(t, []string{"file:///tmp/a%20b.txt", "https://www.deepin.org"},
+		filesToURIs([]string{"/tmp/a b.txt", "https://www.deepin.org"}))
+}
+
+func TestIsWindowOfApp(t *testing.T) {
+	winClass := &icccm.WMClass{Instance: "deepin-music", Class: "Deepin-music"}
+	assert.True(t, isWindowOfApp("deepin-music", nil, winClass, 0))
+	assert.True(t, isWindowOfApp("DEEPIN-MUSIC", nil, winClass, 0))
+	assert.False(t, isWindowOfApp("dde-file-manager", nil, winClass, 0))
+	assert.True(t, isWindowOfApp("", []int{10, 20}, nil, 20))
+	assert.False(t, isWindowOfApp("", []int{10, 20}, nil, 30))
+	assert.False(t, isWindowOfApp("", nil, nil, 0))
+}
+
+func TestGetDesktopActionName(t *testing.T) {
+	assert.Equal(t, "new-window", getDesktopActionName("Desktop Action new-window"))
+	assert.Equal(t, "new-window", getDesktopActionName("new-window"))
+}
+
+func TestActivateRunningInstanceWithFiles(t *testing.T) {
+	appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile("testdata/desktop/dde-file-manager.desktop")
+	if !assert.Nil(t, err) {
+		return
+	}
+	// 不是 DBusActivatable 的应用有文件时不激活已运行的实例，由正常的启动流程打开文件
+	m := &StartManager{}
+	activated, err := m.activateRunningInstance(appInfo, appInfo.GetFileName(), 0, []string{"/tmp/a.txt"})
+	assert.Nil(t, err)
+	assert.False(t, activated)
+}
@@ -71,8 +71,6 @@ const (
 
 	cpuFreqAdjustFile   = "/usr/share/startdde/app_startup.conf"
 	performanceGovernor = "performance"
-
-	restartRateLimitSeconds = 60
 )
 
 type StartManager struct {
@@ -81,21 +79,35 @@ type StartManager struct {
 	userAutostartPath   string
 	delayHandler        *mapDelayHandler
 	daemonApps          *daemonApps.Apps
-	restartTimeMap      map[string]time.Time
-	restartTimeMapMu    sync.Mutex
+	restartTracker      *restartTracker
 	proxyChainsConfFile string
 	proxyChainsBin      string
 	appsDir             []string
 	settings            *gio.Settings
 	appsUseProxy        strv.Strv
 	appsDisableScaling  strv.Strv
+	appsScaleFactor     map[string]float64
 	mu                  sync.Mutex
 	appClose            chan *UeMessageItem
 	launchedHooks       []string
+	exitedHooks         []string
+	hookTimeouts        map[string]time.Duration
+	journal             *appJournal
+	startupNotifier     *startupNotifier
+	proxyProfiles       *proxyProfileManager
+	runCommandAudit     *runCommandAudit
+	autostartQueue      *autostartQueue
+	autostartConditions *autostartConditionMonitor
+	autostartInitOnce   sync.Once
+	autostartStage      int32 // 已经启动自启动应用的最后一个 SessionStage
+	appLog              *appLogManager
+	preload             *preloadManager
 
 	NeededMemory     uint64
 	systemPower      *systemPower.Power
 	cpuFreqAdjustMap map[string]int32
+	cpuBoost         *cpuBoostManager
+	cpuBoostOnce     sync.Once
 
 	//nolint
 	signals *struct {
@@ -103,6 +115,31 @@ type StartManager struct {
 			status string
 			name   string
 		}
+
+		AppLaunched struct {
+			name   string
+			pid    uint32
+			cGroup string
+		}
+
+		AppExited struct {
+			name     string
+			pid      uint32
+			exitCode int32
+			signal   int32
+		}
+
+		AppRestartGaveUp struct {
+			name     string
+			attempts uint32
+		}
+
+		AppCrashed struct {
+			appId        string
+			pid          uint32
+			signal       int32
+			coredumpPath string
+		}
 	}
 
 	//nolint
@@ -122,9 +159,32 @@ type StartManager struct {
 		AddAutostart          func() `in:"filename" out:"ok"`
 		RemoveAutostart       func() `in:"filename" out:"ok"`
 		IsAutostart           func() `in:"filename" out:"result"`
+		GetLaunchJournal      func() `in:"since" out:"journal"`
+		SetProxyProfile       func() `in:"name,type,host,port,user,password,bypass"`
+		RemoveProxyProfile    func() `in:"name"`
+		GetProxyProfiles      func() `out:"profiles"`
+		SetAppProxy           func() `in:"appId,profile,method"`
+		SetAppScaleFactor     func() `in:"appId,scale"`
+		GetAppsScaleFactor    func() `out:"factors"`
+		GetRunCommandAuditLog func() `in:"since" out:"log"`
+		GetAutostartQueue     func() `out:"state"`
+		GetCpuBoostTable      func() `out:"table"`
+		SetAppCpuBoost        func() `in:"appId,seconds"`
+		SetCpuBoostOptions    func() `in:"enabled,boostOnBattery"`
+		ResetCpuBoostLearned  func() `in:"appId"`
+		ExplainLaunch         func() `in:"desktopFile,action,files" out:"explanation"`
+		OpenURIs              func() `in:"uris,timestamp"`
+		GetAppLog             func() `in:"appId,lines" out:"log"`
+		SetPreloadEnabled     func() `in:"enabled"`
+		GetPreloadStats       func() `out:"stats"`
+		GetAutostartEntries   func() `out:"entries"`
+		SetAutostartDelay     func() `in:"id,seconds"`
+		ResetAutostart        func() `in:"id"`
+		CreateAutostart       func() `in:"exec,name" out:"id"`
 	}
 }
 
+// getLaunchedHooks 返回 hook 目录中的文件名，按文件名排序
 func getLaunchedHooks(dir string) (ret []string) {
 	fileInfoList, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -172,30 +232,32 @@ func (m *StartManager) getCpuFreqAdjustMap(path string) map[string]int32 {
 	return cpuFreqAdjustMap
 }
 
-func (m *StartManager) enableCpuFreqLock(desktopFile string) error {
-	fileName := filepath.Base(desktopFile)
-	event := strings.TrimSuffix(fileName, ".desktop")
-	value, ok := m.cpuFreqAdjustMap[event]
-
-	if ok {
-		err := m.systemPower.LockCpuFreq(0, performanceGovernor, value)
-		if err != nil {
-			return err
-		}
+// getCpuBoostTime 返回启动应用时锁定 CPU 频率的秒数，不需要锁定时返回的错误说明原因
+func (m *StartManager) getCpuBoostTime(desktopFile string) (int32, error) {
+	event := getCpuBoostAppId(desktopFile)
+	var value int32
+	var ok bool
+	if m.cpuBoost != nil {
+		value, ok = m.cpuBoost.getSeconds(event, m.cpuFreqAdjustMap)
 	} else {
-		return fmt.Errorf("application is not in app_startup.conf")
+		value, ok = m.cpuFreqAdjustMap[event]
 	}
-	return nil
+
+	if !ok {
+		return 0, fmt.Errorf("no cpu boost for application %s", event)
+	}
+	if !m.shouldCpuBoost() {
+		return 0, errors.New("cpu boost is disabled in current power state")
+	}
+	return value, nil
 }
 
-func (m *StartManager) execLaunchedHooks(desktopFile, cGroupName string) {
-	for _, name := range m.launchedHooks {
-		p := filepath.Join(launchedHookDir, name)
-		err := exec.Command(p, desktopFile, cGroupName).Run()
-		if err != nil {
-			logger.Warning("run cmd failed:", err)
-		}
+func (m *StartManager) enableCpuFreqLock(desktopFile string) error {
+	value, err := m.getCpuBoostTime(desktopFile)
+	if err != nil {
+		return err
 	}
+	return m.systemPower.LockCpuFreq(0, performanceGovernor, value)
 }
 
 func newStartManager(xConn *x.Conn, service *dbusutil.Service) *StartManager {
@@ -210,6 +272,9 @@ func newStartManager(xConn *x.Conn, service *dbusutil.Service) *StartManager {
 
 	m.appsUseProxy = m.settings.GetStrv(gKeyAppsUseProxy)
 	m.appsDisableScaling = m.settings.GetStrv(gKeyAppsDisableScaling)
+	if hasGSettingsKey(m.settings, gKeyAppsScaleFactor) {
+		m.appsScaleFactor = parseAppsScaleFactor(m.settings.GetStrv(gKeyAppsScaleFactor))
+	}
 
 	gsettings.ConnectChanged(gSchemaLauncher, "*", func(key string) {
 		switch key {
@@ -221,6 +286,11 @@ func newStartManager(xConn *x.Conn, service *dbusutil.Service) *StartManager {
 			m.mu.Lock()
 			m.appsDisableScaling = strv.Strv(m.settings.GetStrv(key))
 			m.mu.Unlock()
+		case gKeyAppsScaleFactor:
+			factors := parseAppsScaleFactor(m.settings.GetStrv(key))
+			m.mu.Lock()
+			m.appsScaleFactor = factors
+			m.mu.Unlock()
 		default:
 			return
 		}
@@ -235,11 +305,25 @@ func newStartManager(xConn *x.Conn, service *dbusutil.Service) *StartManager {
 	m.proxyChainsConfFile = filepath.Join(basedir.GetUserConfigDir(), "deepin", "proxychains.conf")
 	m.proxyChainsBin, _ = exec.LookPath(proxychainsBinary)
 	logger.Debugf("startManager proxychain confFile %q, bin: %q", m.proxyChainsConfFile, m.proxyChainsBin)
-
-	m.restartTimeMap = make(map[string]time.Time)
+	m.proxyProfiles = newProxyProfileManager(getProxyProfilesFile())
+
+	m.restartTracker = newRestartTracker()
+	m.journal = newAppJournal(getAppJournalFile())
+	m.runCommandAudit = newRunCommandAudit(getRunCommandAuditFile())
+	var appLogMode string
+	if _gSettingsConfig != nil {
+		appLogMode = _gSettingsConfig.appLogMode
+	}
+	m.appLog = newAppLogManager(appLogMode, getAppLogDir())
+	m.autostartQueue = newAutostartQueue(defaultAutostartConcurrency, m.launchAutostartItem,
+		m.getRunningPids)
+	m.startupNotifier = newStartupNotifier(xConn)
 	m.launchedHooks = getLaunchedHooks(launchedHookDir)
+	m.exitedHooks = getLaunchedHooks(exitedHookDir)
+	m.hookTimeouts = loadHookTimeouts(hooksConfigFile)
+	m.autostartConditions = newAutostartConditionMonitor(m.isAutostart, m.handleAutostartConditionChanged)
 	m.delayHandler = newMapDelayHandler(100*time.Millisecond,
-		m.emitSignalAutostartChanged)
+		m.handleAutostartFileChanged)
 	sysBus, err := dbus.SystemBus()
 	if err != nil {
 		logger.Warning(err)
@@ -248,6 +332,8 @@ func newStartManager(xConn *x.Conn, service *dbusutil.Service) *StartManager {
 	m.daemonApps = daemonApps.NewApps(sysBus)
 	m.systemPower = systemPower.NewPower(sysBus)
 	m.cpuFreqAdjustMap = m.getCpuFreqAdjustMap(cpuFreqAdjustFile)
+	m.cpuBoost = newCpuBoostManager(getCpuBoostFile(), m.getRunningPids)
+	m.preload = newPreloadManager(getPreloadFile())
 	return m
 }
 
@@ -257,21 +343,6 @@ func (m *StartManager) GetInterfaceName() string {
 	return startManagerInterface
 }
 
-func (m *StartManager) getRestartTime(appInfo *desktopappinfo.DesktopAppInfo) (time.Time, bool) {
-	filename := appInfo.GetFileName()
-	m.restartTimeMapMu.Lock()
-	t, ok := m.restartTimeMap[filename]
-	m.restartTimeMapMu.Unlock()
-	return t, ok
-}
-
-func (m *StartManager) setRestartTime(appInfo *desktopappinfo.DesktopAppInfo, t time.Time) {
-	filename := appInfo.GetFileName()
-	m.restartTimeMapMu.Lock()
-	m.restartTimeMap[filename] = t
-	m.restartTimeMapMu.Unlock()
-}
-
 func (m *StartManager) GetApps() (map[uint32]string, *dbus.Error) {
 	if swapSchedDispatcher == nil {
 		return nil, dbusutil.ToError(errors.New("swap-sched disabled"))
@@ -280,6 +351,81 @@ func (m *StartManager) GetApps() (map[uint32]string, *dbus.Error) {
 	return swapSchedDispatcher.GetAppsSeqDescMap(), nil
 }
 
+// GetLaunchJournal 以 JSON 格式返回本次会话中 since(unix 毫秒时间)之后启动的进程记录
+func (m *StartManager) GetLaunchJournal(sender dbus.Sender, since int64) (string, *dbus.Error) {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := m.journal.dump(since)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SetProxyProfile 添加或修改代理配置，proxyType 可以是 http、https、socks4 或 socks5
+func (m *StartManager) SetProxyProfile(sender dbus.Sender, name, proxyType, host string, port uint32,
+	user, password string, bypass []string) *dbus.Error {
+
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.proxyProfiles.setProfile(name, &ProxyProfile{
+		Type:     proxyType,
+		Host:     host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		Bypass:   bypass,
+	})
+	return dbusutil.ToError(err)
+}
+
+func (m *StartManager) RemoveProxyProfile(sender dbus.Sender, name string) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.proxyProfiles.removeProfile(name)
+	return dbusutil.ToError(err)
+}
+
+// GetProxyProfiles 以 JSON 格式返回代理配置和应用设置，不包含密码
+func (m *StartManager) GetProxyProfiles() (string, *dbus.Error) {
+	data, err := m.proxyProfiles.dump()
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+// SetAppProxy 设置应用使用的代理配置，profile 为空表示取消，
+// method 可以是 proxychains、proxy-server、env，为空时自动选择
+func (m *StartManager) SetAppProxy(sender dbus.Sender, appId, profile, method string) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.proxyProfiles.setApp(appId, profile, method)
+	return dbusutil.ToError(err)
+}
+
+// SetAppScaleFactor 设置应用单独使用的缩放比例，scale 为 0 表示跟随桌面
+func (m *StartManager) SetAppScaleFactor(sender dbus.Sender, appId string, scale float64) *dbus.Error {
+	err := checkDMsgUid(m.service, sender)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.setAppScaleFactor(appId, scale)
+	return dbusutil.ToError(err)
+}
+
+func (m *StartManager) GetAppsScaleFactor() (map[string]float64, *dbus.Error) {
+	return m.getAppsScaleFactor(), nil
+}
+
 // deprecated
 func (m *StartManager) Launch(sender dbus.Sender, desktopFile string) (bool, *dbus.Error) {
 	err := checkDMsgUid(m.service, sender)
@@ -313,6 +459,7 @@ func (m *StartManager) LaunchApp(sender dbus.Sender, desktopFile string,
 	return dbusutil.ToError(err)
 }
 
+// LaunchAppWithOptions 支持的 options 见 launch_options.go
 func (m *StartManager) LaunchAppWithOptions(sender dbus.Sender, desktopFile string,
 	timestamp uint32, files []string, options map[string]dbus.Variant) *dbus.Error {
 
@@ -409,7 +556,7 @@ func getCmdDesc(exe string, args []string) string {
 }
 
 func (m *StartManager) RunCommand(sender dbus.Sender, exe string, args []string) *dbus.Error {
-	err := checkDMsgUid(m.service, sender)
+	exe, err := m.checkRunCommand(sender, exe, args, nil)
 	if err != nil {
 		return dbusutil.ToError(err)
 	}
@@ -417,10 +564,11 @@ func (m *StartManager) RunCommand(sender dbus.Sender, exe string, args []string)
 	return dbusutil.ToError(err)
 }
 
+// RunCommandWithOptions 支持的 options 见 launch_options.go
 func (m *StartManager) RunCommandWithOptions(sender dbus.Sender, exe string, args []string,
 	options map[string]dbus.Variant) *dbus.Error {
 
-	err := checkDMsgUid(m.service, sender)
+	exe, err := m.checkRunCommand(sender, exe, args, options)
 	if err != nil {
 		return dbusutil.ToError(err)
 	}
@@ -458,33 +606,81 @@ func (m *StartManager) runCommandWithOptions(exe string, args []string,
 		return nil
 	}
 
-	var uiApp *swapsched.UIApp
-	if swapSchedDispatcher != nil {
-		desc := getCmdDesc(exe, args)
-		uiApp, err = swapSchedDispatcher.NewApp(desc, nil)
+	opts, err := parseLaunchOptions(options)
+	if err != nil {
+		return err
+	}
+	return m.runCommand(exe, args, opts, false)
+}
+
+func (m *StartManager) runCommand(exe string, args []string, opts *launchOptions,
+	autoRestart bool) error {
+
+	var _name = exe
+	if len(args) != 0 {
+		_name += " " + strings.Join(args, " ")
+	}
+	app := &launchedApp{
+		cmdName:       _name,
+		opts:          opts,
+		id:            getScopeId("", exe),
+		exe:           exe,
+		args:          args,
+		autoRestart:   autoRestart,
+		restartPolicy: opts.autoRestart,
+	}
+	var err error
+	desc := getCmdDesc(exe, args)
+	if swapSchedDispatcher != nil && !useSystemdScope() {
+		app.uiApp, err = swapSchedDispatcher.NewApp(desc, nil)
 		if err != nil {
 			logger.Warning("dispatcher.NewApp error:", err)
 		}
 	}
 
+	var cmdline []string
+	cmdline = append(cmdline, opts.cmdPrefix...)
+	cmdline = append(cmdline, exe)
+	cmdline = append(cmdline, args...)
+	cmdline = append(cmdline, opts.cmdSuffix...)
+	exe, args = cmdline[0], cmdline[1:]
+
 	var cmd *exec.Cmd
-	if uiApp != nil {
-		args = append([]string{"-g", "memory:" + uiApp.GetCGroup(), exe}, args...)
-		cmd = exec.Command(globalCgExecBin, args...)
+	var prefix []string
+	if app.uiApp != nil {
+		prefix = getCgroupCmdPrefix("memory", app.uiApp.GetCGroup())
+	} else if useSystemdScope() {
+		app.scope = newAppScopeName(app.id)
+		prefix = getScopeWaitPrefix(app.scope)
+	}
+	if len(prefix) > 0 {
+		args = append(append(prefix[1:], exe), args...)
+		cmd = exec.Command(prefix[0], args...)
 	} else {
 		cmd = exec.Command(exe, args...)
 	}
 
-	if dirVar, ok := options["dir"]; ok {
-		if dirStr, ok := dirVar.Value().(string); ok {
-			cmd.Dir = dirStr
-		} else {
-			return errors.New("type of option dir is not string")
-		}
+	files, err := opts.applyToCmd(cmd)
+	if err != nil {
+		// cgroup 已经创建，交给 waitCmd 处理
+		return m.waitCmd(app, cmd, err)
+	}
+	app.output, err = m.appLog.capturePipe(app.id, cmd)
+	if err != nil {
+		logger.Warning("failed to capture output:", err)
 	}
 
 	err = cmd.Start()
-	return m.waitCmd(nil, cmd, err, uiApp, _name)
+	closeFiles(files)
+	if err == nil && app.scope != "" {
+		app.scopeUnit, err = startAppScope(app.scope, desc, cmd.Process.Pid, nil)
+		if err != nil {
+			logger.Warning("failed to start transient scope:", err)
+			app.scope = ""
+			err = nil
+		}
+	}
+	return m.waitCmd(app, cmd, err)
 }
 
 func (m *StartManager) getAppIdByFilePath(file string) string {
@@ -492,10 +688,6 @@ func (m *StartManager) getAppIdByFilePath(file string) string {
 }
 
 func (m *StartManager) shouldUseProxy(id string) bool {
-	// check if need ignore use proxy
-	if ignoreUseProxy(id) {
-		return false
-	}
 	m.mu.Lock()
 	if !m.appsUseProxy.Contains(id) {
 		m.mu.Unlock()
@@ -507,14 +699,7 @@ func (m *StartManager) shouldUseProxy(id string) bool {
 		return false
 	}
 
-	if m.proxyChainsBin == "" {
-		// try get proxyChainsBin again
-		m.proxyChainsBin, _ = exec.LookPath(proxychainsBinary)
-		if m.proxyChainsBin == "" {
-			return false
-		}
-	}
-	return true
+	return m.getProxyChainsBin() != ""
 }
 
 func (m *StartManager) shouldDisableScaling(id string) bool {
@@ -524,82 +709,127 @@ func (m *StartManager) shouldDisableScaling(id string) bool {
 	return contains
 }
 
+// getAppCmdArgs 返回应用的代理和缩放设置需要的命令前缀和后缀，dryRun 时不写入代理配置文件
+func (m *StartManager) getAppCmdArgs(appId string, appInfo *desktopappinfo.DesktopAppInfo,
+	dryRun bool) (cmdPrefixes, cmdSuffixes []string) {
+	proxyMeta := getAppProxyMetadata(appInfo)
+	if profileName, profile, method := m.proxyProfiles.getApp(appId); profile != nil {
+		method = m.resolveProxyMethod(appId, proxyMeta, method)
+		prefixes, suffixes, err := m.getProxyCmdArgs(profileName, profile, method,
+			proxyMeta.argument, "", dryRun)
+		if err == nil {
+			cmdPrefixes = append(cmdPrefixes, prefixes...)
+			cmdSuffixes = append(cmdSuffixes, suffixes...)
+		} else {
+			logger.Warningf("failed to use proxy profile %q: %v", profileName, err)
+		}
+	} else if m.shouldUseProxy(appId) {
+		logger.Debug("launch: use proxy")
+		method := m.resolveProxyMethod(appId, proxyMeta, proxyMethodAuto)
+		var prefixes, suffixes []string
+		var profile *ProxyProfile
+		var err error
+		// 全局 proxychains 配置已经存在，其他方式需要读取代理地址
+		if method != proxyMethodProxyChains && method != proxyMethodSelf {
+			profile, err = loadLegacyProxyProfile()
+		}
+		if err == nil {
+			prefixes, suffixes, err = m.getProxyCmdArgs("", profile, method,
+				proxyMeta.argument, m.proxyChainsConfFile, dryRun)
+		}
+		if err == nil {
+			cmdPrefixes = append(cmdPrefixes, prefixes...)
+			cmdSuffixes = append(cmdSuffixes, suffixes...)
+		} else {
+			logger.Warning("failed to use proxy:", err)
+		}
+	}
+	if scale, ok := m.getAppScaleFactor(appId); ok {
+		logger.Debug("launch: use scale factor", scale)
+		cmdPrefixes = append(cmdPrefixes, "/usr/bin/env")
+		cmdPrefixes = append(cmdPrefixes, getScaleEnv(scale, getGlobalScaleFactor())...)
+		if isElectronApp(appInfo) {
+			cmdSuffixes = append(cmdSuffixes, "--force-device-scale-factor="+formatScale(scale))
+		}
+	} else if m.shouldDisableScaling(appId) {
+		logger.Debug("launch: disable scaling")
+		cmdPrefixes = append(cmdPrefixes, "/usr/bin/env")
+		cmdPrefixes = append(cmdPrefixes, getDisableScalingEnv(getGlobalScaleFactor())...)
+	}
+	return
+}
+
 type IStartCommand interface {
 	StartCommand(files []string, ctx *appinfo.AppLaunchContext) (*exec.Cmd, error)
 }
 
 func (m *StartManager) launch(appInfo *desktopappinfo.DesktopAppInfo, timestamp uint32,
-	files []string, iStartCmd IStartCommand, cmdName string) error {
-
-	// maximum RAM unit is MB
-	maxRAM, _ := appInfo.GetUint64(desktopappinfo.MainSection, "X-Deepin-MaximumRAM")
-	// unit is MB/s
-	blkioReadMBPS, _ := appInfo.GetUint64(desktopappinfo.MainSection, "X-Deepin-BlkioReadMBPS")
-	blkioWriteMBPS, _ := appInfo.GetUint64(desktopappinfo.MainSection, "X-Deepin-BlkioWriteMBPS")
+	files []string, iStartCmd IStartCommand, cmdName string, opts *launchOptions,
+	autoRestart bool) error {
 
 	desktopFile := appInfo.GetFileName()
 	logger.Debug("launch: desktopFile is", desktopFile)
-	var err error
-	var cmdPrefixes []string
-	var cmdSuffixes []string
-	var uiApp *swapsched.UIApp
+	plan := m.newLaunchPlan(appInfo, "", opts, false)
+	if plan.err != nil {
+		return plan.err
+	}
+	if len(plan.terminal) > 0 {
+		logger.Debug("launch: use terminal", plan.terminal)
+	}
+	app := &launchedApp{
+		appInfo:       appInfo,
+		id:            plan.id,
+		cmdName:       cmdName,
+		opts:          opts,
+		autoRestart:   autoRestart,
+		limit:         plan.limit,
+		restartPolicy: plan.restartPolicy,
+	}
 
-	err = m.enableCpuFreqLock(desktopFile)
+	err := m.enableCpuFreqLock(desktopFile)
 	if err != nil {
 		logger.Debug("cpu freq lock failed:", err)
 	}
-
-	if swapSchedDispatcher != nil {
-		if isDEComponent(appInfo) {
-			cmdPrefixes = []string{globalCgExecBin, "-g", "memory:" + swapSchedDispatcher.GetDECGroup()}
+	// 已有实例运行时新窗口可能来自已有实例，不能用来学习启动时间
+	learnCpuBoost := len(m.getRunningPids(desktopFile)) == 0
+
+	var cgroup, controllers string
+	switch plan.cgroupMethod {
+	case cgroupMethodSystemdScope:
+		logger.Debug("launch: use systemd scope")
+		app.scope = newAppScopeName(app.id)
+		cgroup = app.scope
+	case cgroupMethodDE:
+		cgroup = swapSchedDispatcher.GetDECGroup()
+		controllers = "memory"
+	case cgroupMethodCgexec:
+		logger.Debugf("launch limit: %#v", plan.limit)
+		app.uiApp, err = swapSchedDispatcher.NewApp(desktopFile, plan.limit)
+		if err != nil {
+			logger.Warning("dispatcher.NewApp error:", err)
 		} else {
-			limit := &swapsched.AppResourcesLimit{
-				MemHardLimit:  maxRAM * 1e6,
-				BlkioReadBPS:  blkioReadMBPS * 1e6,
-				BlkioWriteBPS: blkioWriteMBPS * 1e6,
-			}
-			logger.Debugf("launch limit: %#v", limit)
-			uiApp, err = swapSchedDispatcher.NewApp(desktopFile, limit)
-			if err != nil {
-				logger.Warning("dispatcher.NewApp error:", err)
-			} else {
-				logger.Debug("launch: use cgexec")
-				cmdPrefixes = []string{globalCgExecBin, "-g",
-					"memory,freezer,blkio:" + uiApp.GetCGroup()}
-			}
+			logger.Debug("launch: use cgexec")
+			cgroup = app.uiApp.GetCGroup()
+			controllers = app.uiApp.GetCGroupControllers()
 		}
 	}
 
-	appId := m.getAppIdByFilePath(desktopFile)
-	if appId != "" {
-		if m.shouldUseProxy(appId) {
-			logger.Debug("launch: use proxy")
-			if supportProxyServerOption(appId) {
-				proxyServerUrl, err := getProxyServerUrl()
-				if err == nil {
-					cmdSuffixes = append(cmdSuffixes, "--proxy-server="+proxyServerUrl)
-				} else {
-					logger.Warning("failed to get google chrome proxy server url:", err)
-				}
-			} else {
-				cmdPrefixes = append(cmdPrefixes, m.proxyChainsBin, "-f", m.proxyChainsConfFile)
-			}
-		}
-		if m.shouldDisableScaling(appId) {
-			logger.Debug("launch: disable scaling")
-			gs := gio.NewSettings("com.deepin.xsettings")
-			defer gs.Unref()
-			scale := gs.GetDouble("scale-factor")
-			if scale > 0 {
-				scale = 1 / scale
-			} else {
-				scale = 1
-			}
-			qt := "QT_SCALE_FACTOR=" + strconv.FormatFloat(scale, 'f', -1, 64)
-			cmdPrefixes = append(cmdPrefixes, "/usr/bin/env", "GDK_DPI_SCALE=1", "GDK_SCALE=1", qt)
-		}
+	if m.preload.isEnabled() {
+		go m.preload.preloadApp(app.id)
 	}
 
+	app.output, err = m.appLog.captureFifo(app.id)
+	if err != nil {
+		logger.Warning("failed to capture output:", err)
+	}
+
+	startupSeq := m.startupNotifier.begin(appInfo, timestamp)
+	var startupId string
+	if startupSeq != nil {
+		startupId = startupSeq.id
+	}
+	cmdPrefixes, cmdSuffixes := plan.getCmdArgs(cgroup, controllers, app.output.getCmdPrefix(), startupId)
+
 	ctx := appinfo.NewAppLaunchContext(m.xConn)
 	ctx.SetTimestamp(timestamp)
 	if len(cmdPrefixes) > 0 {
@@ -611,18 +841,29 @@ func (m *StartManager) launch(appInfo *desktopappinfo.DesktopAppInfo, timestamp
 		ctx.SetCmdSuffixes(cmdSuffixes)
 	}
 	cmd, err := iStartCmd.StartCommand(files, ctx)
-
-	// exec launched hooks
-	cGroupName := ""
-	if uiApp != nil {
-		cGroupName = uiApp.GetCGroup()
+	if err == nil && learnCpuBoost {
+		m.beginCpuBoostLearning(appInfo)
+	}
+	if startupSeq != nil {
+		if err != nil {
+			m.startupNotifier.end(startupSeq)
+		} else {
+			m.startupNotifier.setPid(startupSeq, cmd.Process.Pid)
+		}
+	}
+	if err == nil && app.scope != "" {
+		app.scopeUnit, err = startAppScope(app.scope, appInfo.GetName(), cmd.Process.Pid, plan.limit)
+		if err != nil {
+			logger.Warning("failed to start transient scope:", err)
+			app.scope = ""
+			err = nil
+		}
 	}
-	go m.execLaunchedHooks(desktopFile, cGroupName)
 
 	item := &UeMessageItem{Path: appInfo.GetFileName(), Name: appInfo.GetName(), Id: appInfo.GetId()}
 	go sendAppDataMsgToUserExperModule(UserExperOpenApp, item)
 
-	return m.waitCmd(appInfo, cmd, err, uiApp, cmdName)
+	return m.waitCmd(app, cmd, err)
 }
 
 func (m *StartManager) listenAppCloseEvent() error {
@@ -681,15 +922,33 @@ func (m *StartManager) launchApp(desktopFile string, timestamp uint32, files []s
 		return err
 	}
 
-	if pathVar, ok := options["path"]; ok {
-		pathStr, isStr := pathVar.Value().(string)
-		if !isStr {
-			return errors.New("type of option path is not string")
+	opts, err := parseLaunchOptions(options)
+	if err != nil {
+		return err
+	}
+	if opts.dir != "" {
+		appInfo.SetString(desktopappinfo.MainSection, desktopappinfo.KeyPath, opts.dir)
+	}
+
+	if isSingleInstance(appInfo) {
+		activated, err := m.activateRunningInstance(appInfo, desktopFile, timestamp, files)
+		if err != nil {
+			return fmt.Errorf("failed to activate running instance: %v", err)
+		}
+		if activated {
+			return nil
 		}
-		appInfo.SetString(desktopappinfo.MainSection, desktopappinfo.KeyPath, pathStr)
 	}
 
-	return m.launch(appInfo, timestamp, files, appInfo, desktopFile)
+	if getLaunchMethod(appInfo, opts) == launchMethodDBusActivation {
+		err = m.activateDBusApp(appInfo, desktopFile, "", timestamp, files)
+		if err == nil {
+			return nil
+		}
+		logger.Warningf("failed to activate %s, fall back to exec: %v", desktopFile, err)
+	}
+
+	return m.launch(appInfo, timestamp, files, appInfo, desktopFile, opts, false)
 }
 
 func (m *StartManager) launchAppActionAux(desktopFile, actionSection string, timestamp uint32) error {
@@ -710,21 +969,104 @@ func (m *StartManager) launchAppActionAux(desktopFile, actionSection string, tim
 		return fmt.Errorf("not found section %q in %q", actionSection, desktopFile)
 	}
 
-	return m.launch(appInfo, timestamp, nil, &targetAction, desktopFile+actionSection)
+	if getLaunchMethod(appInfo, nil) == launchMethodDBusActivation {
+		err = m.activateDBusApp(appInfo, desktopFile, targetAction.Section, timestamp, nil)
+		if err == nil {
+			return nil
+		}
+		logger.Warningf("failed to activate action %s of %s, fall back to exec: %v",
+			actionSection, desktopFile, err)
+	}
+
+	return m.launch(appInfo, timestamp, nil, &targetAction, desktopFile+actionSection, nil, false)
+}
+
+// launchedApp 保存一次启动的相关信息，由 launch 和 runCommandWithOptions 传给 waitCmd
+type launchedApp struct {
+	appInfo     *desktopappinfo.DesktopAppInfo // nil for RunCommand
+	id          string                         // app id 或命令的文件名，用于日志和 AppCrashed 信号
+	cmdName     string
+	uiApp       *swapsched.UIApp
+	scope       string // systemd transient scope unit name
+	scopeUnit   *appScopeUnit
+	opts        *launchOptions
+	autoRestart bool                         // 是否为自动重启
+	limit       *swapsched.AppResourcesLimit // 传给 hook
+	output      *appOutputCapture
+	hooksDone   chan struct{} // launched hook 执行完后关闭，exited hook 要等它关闭后再执行
+
+	restartPolicy string
+	exe           string   // RunCommand 的程序，用于重启
+	args          []string // RunCommand 的参数，用于重启
+}
+
+// getAutostartCookie 返回自启动队列传给应用的 cookie，不是自启动的应用返回空
+func (app *launchedApp) getAutostartCookie() string {
+	if app.opts == nil {
+		return ""
+	}
+	return app.opts.env[envSessionProcessCookieId]
+}
+
+func (app *launchedApp) cGroupName() string {
+	if app.uiApp != nil {
+		return app.uiApp.GetCGroup()
+	}
+	return app.scope
 }
 
-func (m *StartManager) waitCmd(appInfo *desktopappinfo.DesktopAppInfo, cmd *exec.Cmd, err error,
-	uiApp *swapsched.UIApp, cmdName string) error {
+func (m *StartManager) waitCmd(app *launchedApp, cmd *exec.Cmd, err error) error {
+	appInfo := app.appInfo
+	uiApp := app.uiApp
 	if uiApp != nil {
 		swapSchedDispatcher.AddApp(uiApp)
 	}
 
 	if err != nil {
+		app.output.release()
 		return err
 	}
+	app.output.closeWriter()
+
+	var desktopFile string
+	if appInfo != nil {
+		desktopFile = appInfo.GetFileName()
+	}
+	rec := m.journal.addLaunch(desktopFile, cmd, app.cGroupName(), app.autoRestart)
+	m.emitSignalAppLaunched(rec)
+	oom := newOOMWatcher(app.getMemoryCgroup(rec.Pid), app.scopeUnit)
+	if cookie := app.getAutostartCookie(); cookie != "" && m.autostartQueue != nil {
+		m.autostartQueue.setPid(cookie, rec.Pid)
+	}
+	if appInfo != nil {
+		app.hooksDone = make(chan struct{})
+		launchedPayload := newAppHookPayload(hookEventLaunched, app, rec)
+		go func() {
+			m.execHooks(hookEventLaunched, launchedPayload)
+			close(app.hooksDone)
+		}()
+		m.recordAppFiles(app, rec.Pid)
+	}
 
 	go func() {
 		err := cmd.Wait()
+		app.output.release()
+		m.journal.setExited(rec, cmd.ProcessState, oom.killed())
+		m.emitSignalAppExited(rec)
+		// 自启动应用在注册或映射窗口前就退出了，也要让出位置
+		if cookie := app.getAutostartCookie(); cookie != "" && m.autostartQueue != nil {
+			m.autostartQueue.releaseCookie(cookie, autostartReasonExited)
+		}
+		if isCrash(rec.Termination, rec.Signal) {
+			go m.handleAppCrash(app, rec)
+		}
+		if appInfo != nil {
+			exitedPayload := newAppHookPayload(hookEventExited, app, rec)
+			go func() {
+				<-app.hooksDone
+				m.execHooks(hookEventExited, exitedPayload)
+			}()
+		}
 
 		// send app close info to ue module
 		// we did not care the program exit normal or not
@@ -734,31 +1076,8 @@ func (m *StartManager) waitCmd(appInfo *desktopappinfo.DesktopAppInfo, cmd *exec
 		}
 
 		if err != nil {
-			logger.Warningf("%v: %v", cmd.Args, err)
-
-			if appInfo != nil {
-				autoRestart, _ := appInfo.GetBool(desktopappinfo.MainSection, KeyXGnomeAutoRestart)
-				if autoRestart {
-					now := time.Now()
-
-					canLaunch := true
-					if lastRestartTime, ok := m.getRestartTime(appInfo); ok {
-						elapsed := now.Sub(lastRestartTime)
-						if elapsed < restartRateLimitSeconds*time.Second {
-							logger.Warningf("app %q re-spawning too quickly", appInfo.GetFileName())
-							canLaunch = false
-						}
-					}
-
-					if canLaunch {
-						err = m.launch(appInfo, 0, nil, appInfo, appInfo.GetFileName())
-						if err != nil {
-							logger.Warningf("failed to restart app %q", appInfo.GetFileName())
-						}
-						m.setRestartTime(appInfo, now)
-					}
-				}
-			}
+			logger.Warningf("%v: %v, termination: %s", cmd.Args, err, rec.Termination)
+			m.restartApp(app, rec)
 		}
 		if uiApp != nil {
 			uiApp.SetStateEnd()
@@ -766,7 +1085,7 @@ func (m *StartManager) waitCmd(appInfo *desktopappinfo.DesktopAppInfo, cmd *exec
 	}()
 	if uiApp != nil {
 		go func() {
-			err := saveNeededMemory(cmdName, uiApp.GetCGroup())
+			err := saveNeededMemory(app.cmdName, uiApp.GetCGroup())
 			if err != nil {
 				logger.Warning(err)
 			}
@@ -785,6 +1104,9 @@ const (
 	AutostartAdded         = "added"
 	AutostartDeleted       = "deleted"
 	SignalAutostartChanged = "AutostartChanged"
+
+	signalAppLaunched = "AppLaunched"
+	signalAppExited   = "AppExited"
 )
 
 func (m *StartManager) emitSignalAutostartChanged(name string) {
@@ -801,6 +1123,21 @@ func (m *StartManager) emitSignalAutostartChanged(name string) {
 	}
 }
 
+func (m *StartManager) emitSignalAppLaunched(rec *AppLaunchRecord) {
+	err := m.service.Emit(m, signalAppLaunched, rec.name(), uint32(rec.Pid), rec.CGroup)
+	if err != nil {
+		logger.Warning("failed to emit signal AppLaunched:", err)
+	}
+}
+
+func (m *StartManager) emitSignalAppExited(rec *AppLaunchRecord) {
+	err := m.service.Emit(m, signalAppExited, rec.name(), uint32(rec.Pid),
+		int32(rec.ExitCode), int32(rec.Signal))
+	if err != nil {
+		logger.Warning("failed to emit signal AppExited:", err)
+	}
+}
+
 func (m *StartManager) listenAutostartFileEvents() {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -893,7 +1230,18 @@ func (m *StartManager) isAutostartAux(filename string) bool {
 	if dai.GetIsHiden() {
 		return false
 	}
-	return dai.GetShowIn(nil)
+	enabled, err := dai.GetBool(desktopappinfo.MainSection, KeyXGnomeAutostartEnabled)
+	if err == nil && !enabled {
+		return false
+	}
+	if !dai.GetShowIn(nil) {
+		return false
+	}
+	tryExec, _ := dai.GetString(desktopappinfo.MainSection, KeyTryExec)
+	if !isTryExecAvailable(tryExec) {
+		return false
+	}
+	return checkAutostartCondition(dai)
 }
 
 func lowerBaseName(name string) string {
@@ -1095,25 +1443,11 @@ func startStartManager(xConn *x.Conn, service *dbusutil.Service) {
 	}
 }
 
+// startAutostartProgram 启动 Applications 阶段的自启动应用
 func startAutostartProgram() {
-	// may be start N programs, like 5, at the same time is better than starting all programs at the same time.
-	autoStartList, _ := _startManager.AutostartList()
-	for _, desktopFile := range autoStartList {
-		go func(desktopFile string) {
-			delay, err := getDelayTime(desktopFile)
-			if err != nil {
-				logger.Warning(err)
-			}
-
-			if delay != 0 {
-				time.Sleep(delay)
-			}
-			err = _startManager.launchAppWithOptions(desktopFile, 0, nil, nil)
-			if err != nil {
-				logger.Warning(err)
-			}
-		}(desktopFile)
-	}
+	m := _startManager
+	m.startAutostartStage(SessionStageAppsBegin)
+	go m.preload.preloadAtLogin()
 }
 
 func isAppInList(app string, apps []string) bool {
@@ -1125,6 +1459,7 @@ func isAppInList(app string, apps []string) bool {
 	return false
 }
 
+// ignoreUseProxy 用于兼容没有声明 X-Deepin-ProxyMode=self 的应用
 func ignoreUseProxy(id string) bool {
 	// deepin-app-store and deepin-manual implement proxy themselves, should be ignored
 	if id == "deepin-app-store" || id == "deepin-manual" {
@@ -23,10 +23,8 @@ import (
 	"fmt"
 	"os"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
-	"pkg.deepin.io/lib/appinfo/desktopappinfo"
 )
 
 func _TestSetAutostart(t *testing.T) { //nolint
@@ -175,52 +173,3 @@ func TestStartManager_enableCpuFreqLock(t *testing.T) {
 		})
 	}
 }
-
-func TestStartManager_getRestartTime(t *testing.T) {
-	type args struct {
-		appInfo *desktopappinfo.DesktopAppInfo
-	}
-	type test struct {
-		name    string
-		obj     *StartManager
-		args    args
-		want    time.Time
-		wantSec bool
-	}
-	tests := []test{
-		func() test {
-			appInfo, _ := desktopappinfo.NewDesktopAppInfoFromFile("testdata/desktop/dde-file-manager.desktop")
-			now := time.Now()
-			return test{
-				name: "StartManager_getRestartTime",
-				obj: &StartManager{
-					restartTimeMap: map[string]time.Time{appInfo.GetFileName(): now},
-				},
-				args: args{
-					appInfo: appInfo,
-				},
-				want:    now,
-				wantSec: true,
-			}
-		}(),
-		func() test {
-			appInfo, _ := desktopappinfo.NewDesktopAppInfoFromFile("testdata/desktop/dde-file-manager.desktop")
-			return test{
-				name: "StartManager_getRestartTime_notExist",
-				obj:  &StartManager{},
-				args: args{
-					appInfo: appInfo,
-				},
-				want:    time.Time{},
-				wantSec: false,
-			}
-		}(),
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, got1 := tt.obj.getRestartTime(tt.args.appInfo)
-			assert.Equal(t, tt.want, got)
-			assert.Equal(t, tt.wantSec, got1)
-		})
-	}
-}
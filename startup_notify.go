@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+// XDG startup-notification 协议的实现，
+// 见 https://specifications.freedesktop.org/startup-notification-spec/startup-notification-latest.txt
+
+const (
+	KeyStartupNotify = "StartupNotify"
+
+	startupNotifyTimeout = 15 * time.Second
+	// 每个 ClientMessage 最多携带 20 字节
+	startupInfoChunkSize = 20
+
+	busyCursorName   = "left_ptr_watch"
+	normalCursorName = "left_ptr"
+)
+
+type startupSequence struct {
+	id      string
+	wmClass string
+	pid     int
+	timer   *time.Timer
+}
+
+type windowInfo struct {
+	win       x.Window
+	pid       int
+	wmClass   icccm.WMClass
+	startupId string
+}
+
+// startupNotifier 发送启动通知，有应用在启动时把根窗口的光标设为忙碌光标
+type startupNotifier struct {
+	xConn     *x.Conn
+	cursorMu  sync.Mutex
+	mu        sync.Mutex
+	sequences map[string]*startupSequence
+	seq       uint32
+	watchOnce sync.Once
+
+	senderOnce sync.Once
+	senderWin  x.Window
+	senderErr  error
+
+	windowHandlersMu sync.Mutex
+	windowHandlers   []func(info *windowInfo)
+}
+
+func newStartupNotifier(xConn *x.Conn) *startupNotifier {
+	return &startupNotifier{
+		xConn:     xConn,
+		sequences: make(map[string]*startupSequence),
+	}
+}
+
+// needStartupNotify 只有声明支持启动通知或可以通过 StartupWMClass 识别窗口的应用才发送启动通知
+func needStartupNotify(appInfo *desktopappinfo.DesktopAppInfo) (bool, string) {
+	wmClass, _ := appInfo.GetString(desktopappinfo.MainSection, KeyStartupWMClass)
+	notify, _ := appInfo.GetBool(desktopappinfo.MainSection, KeyStartupNotify)
+	return notify || wmClass != "", wmClass
+}
+
+func (sn *startupNotifier) newStartupId(name string, timestamp uint32) string {
+	seq := atomic.AddUint32(&sn.seq, 1)
+	name = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	return fmt.Sprintf("startdde-%s-%d-%d_TIME%d", name, os.Getpid(), seq, timestamp)
+}
+
+// quoteStartupInfoValue 按协议对值加引号并转义
+func quoteStartupInfoValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return `"` + v + `"`
+}
+
+func makeStartupInfoMessage(typ string, keys []string, values map[string]string) string {
+	var buf bytes.Buffer
+	buf.WriteString(typ)
+	buf.WriteString(":")
+	for _, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		buf.WriteString(" ")
+		buf.WriteString(key)
+		buf.WriteString("=")
+		buf.WriteString(quoteStartupInfoValue(value))
+	}
+	return buf.String()
+}
+
+// splitStartupInfoMessage 把以 nul 结尾的消息切分成多个 ClientMessage 的数据
+func splitStartupInfoMessage(msg string) [][]byte {
+	data := append([]byte(msg), 0)
+	var chunks [][]byte
+	for len(data) > 0 {
+		chunk := make([]byte, startupInfoChunkSize)
+		n := copy(chunk, data)
+		data = data[n:]
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// makeClientMessageEvent 构造 ClientMessage 事件，用于 SendEvent
+func makeClientMessageEvent(format uint8, win x.Window, typ x.Atom, data []byte) []byte {
+	ev := make([]byte, 32)
+	ev[0] = x.ClientMessageEventCode
+	ev[1] = format
+	binary.LittleEndian.PutUint32(ev[4:], uint32(win))
+	binary.LittleEndian.PutUint32(ev[8:], uint32(typ))
+	copy(ev[12:], data)
+	return ev
+}
+
+// createSenderWindow 创建不映射的 InputOnly 窗口作为启动通知消息的发送者
+func createSenderWindow(conn *x.Conn) (x.Window, error) {
+	xid, err := conn.AllocID()
+	if err != nil {
+		return 0, err
+	}
+	win := x.Window(xid)
+	root := conn.GetDefaultScreen().Root
+	err = x.CreateWindowChecked(conn, 0, win, root,
+		-100, -100, 1, 1, 0,
+		x.WindowClassInputOnly, x.CopyFromParent,
+		0, nil).Check(conn)
+	if err != nil {
+		return 0, err
+	}
+	return win, nil
+}
+
+// getSenderWindow 返回发送者窗口，协议要求消息的 window 字段是发送者自己的窗口，不能使用根窗口
+func (sn *startupNotifier) getSenderWindow() (x.Window, error) {
+	sn.senderOnce.Do(func() {
+		sn.senderWin, sn.senderErr = createSenderWindow(sn.xConn)
+	})
+	return sn.senderWin, sn.senderErr
+}
+
+// broadcast 以发送者窗口的名义向根窗口广播消息
+func (sn *startupNotifier) broadcast(msg string) error {
+	sender, err := sn.getSenderWindow()
+	if err != nil {
+		return err
+	}
+	atomBegin, err := sn.xConn.GetAtom("_NET_STARTUP_INFO_BEGIN")
+	if err != nil {
+		return err
+	}
+	atomInfo, err := sn.xConn.GetAtom("_NET_STARTUP_INFO")
+	if err != nil {
+		return err
+	}
+
+	root := sn.xConn.GetDefaultScreen().Root
+	for idx, chunk := range splitStartupInfoMessage(msg) {
+		typ := atomInfo
+		if idx == 0 {
+			typ = atomBegin
+		}
+		ev := makeClientMessageEvent(8, sender, typ, chunk)
+		err = x.SendEventChecked(sn.xConn, false, root, x.EventMaskPropertyChange, ev).Check(sn.xConn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// begin 开始一个启动序列并返回它，不需要启动通知时返回 nil
+func (sn *startupNotifier) begin(appInfo *desktopappinfo.DesktopAppInfo, timestamp uint32) *startupSequence {
+	if sn.xConn == nil {
+		return nil
+	}
+	need, wmClass := needStartupNotify(appInfo)
+	if !need {
+		return nil
+	}
+	sn.startWatchWindows()
+
+	name := strings.TrimSuffix(filepath.Base(appInfo.GetFileName()), desktopExt)
+	seq := &startupSequence{
+		id:      sn.newStartupId(name, timestamp),
+		wmClass: wmClass,
+	}
+	values := map[string]string{
+		"ID":             seq.id,
+		"NAME":           appInfo.GetName(),
+		"SCREEN":         "0",
+		"BIN":            appInfo.GetExecutable(),
+		"ICON":           appInfo.GetIcon(),
+		"DESCRIPTION":    "Launching " + appInfo.GetName(),
+		"WMCLASS":        wmClass,
+		"APPLICATION_ID": appInfo.GetFileName(),
+		"TIMESTAMP":      fmt.Sprint(timestamp),
+	}
+	if wmClass == "" {
+		delete(values, "WMCLASS")
+	}
+	msg := makeStartupInfoMessage("new", []string{"ID", "NAME", "SCREEN", "BIN", "ICON",
+		"DESCRIPTION", "WMCLASS", "APPLICATION_ID", "TIMESTAMP"}, values)
+	err := sn.broadcast(msg)
+	if err != nil {
+		logger.Warning("failed to send startup notification:", err)
+		return nil
+	}
+
+	sn.mu.Lock()
+	sn.sequences[seq.id] = seq
+	if len(sn.sequences) == 1 {
+		go sn.updateCursor()
+	}
+	seq.timer = time.AfterFunc(startupNotifyTimeout, func() {
+		logger.Debugf("startup sequence %s timeout", seq.id)
+		sn.end(seq)
+	})
+	sn.mu.Unlock()
+	return seq
+}
+
+func (sn *startupNotifier) startWatchWindows() {
+	sn.watchOnce.Do(func() {
+		go sn.watchWindows()
+	})
+}
+
+// addWindowHandler 添加新窗口出现时的回调，回调在监听窗口的 goroutine 中执行
+func (sn *startupNotifier) addWindowHandler(fn func(info *windowInfo)) {
+	sn.windowHandlersMu.Lock()
+	sn.windowHandlers = append(sn.windowHandlers, fn)
+	sn.windowHandlersMu.Unlock()
+	sn.startWatchWindows()
+}
+
+func (sn *startupNotifier) setPid(seq *startupSequence, pid int) {
+	sn.mu.Lock()
+	seq.pid = pid
+	sn.mu.Unlock()
+}
+
+// end 结束启动序列，发送 remove 消息，没有启动中的应用时恢复光标
+func (sn *startupNotifier) end(seq *startupSequence) {
+	sn.mu.Lock()
+	if _, ok := sn.sequences[seq.id]; !ok {
+		sn.mu.Unlock()
+		return
+	}
+	delete(sn.sequences, seq.id)
+	seq.timer.Stop()
+	if len(sn.sequences) == 0 {
+		go sn.updateCursor()
+	}
+	sn.mu.Unlock()
+
+	msg := makeStartupInfoMessage("remove", []string{"ID"}, map[string]string{"ID": seq.id})
+	err := sn.broadcast(msg)
+	if err != nil {
+		logger.Warning("failed to send startup notification:", err)
+	}
+}
+
+// updateCursor 有应用在启动时显示忙碌光标，否则恢复普通光标，
+// 在 cursorMu 中读取当前状态，多次调用的顺序不影响最终的光标
+func (sn *startupNotifier) updateCursor() {
+	sn.cursorMu.Lock()
+	defer sn.cursorMu.Unlock()
+
+	sn.mu.Lock()
+	busy := len(sn.sequences) > 0
+	sn.mu.Unlock()
+	if busy {
+		setRootCursor(busyCursorName)
+	} else {
+		setRootCursor(normalCursorName)
+	}
+}
+
+func (seq *startupSequence) matchWindow(info *windowInfo) bool {
+	if info.startupId != "" {
+		return info.startupId == seq.id
+	}
+	if seq.wmClass != "" && (strings.EqualFold(info.wmClass.Instance, seq.wmClass) ||
+		strings.EqualFold(info.wmClass.Class, seq.wmClass)) {
+		return true
+	}
+	return seq.pid != 0 && seq.pid == info.pid
+}
+
+// handleNewWindow 应用映射窗口后结束它的启动序列
+func (sn *startupNotifier) handleNewWindow(info *windowInfo) {
+	sn.mu.Lock()
+	var matched []*startupSequence
+	for _, seq := range sn.sequences {
+		if seq.matchWindow(info) {
+			matched = append(matched, seq)
+		}
+	}
+	sn.mu.Unlock()
+
+	for _, seq := range matched {
+		logger.Debugf("startup sequence %s complete, window %d", seq.id, info.win)
+		sn.end(seq)
+	}
+
+	sn.windowHandlersMu.Lock()
+	handlers := sn.windowHandlers
+	sn.windowHandlersMu.Unlock()
+	for _, fn := range handlers {
+		fn(info)
+	}
+}
+
+func getWindowInfo(conn *x.Conn, win x.Window, atomStartupId x.Atom) *windowInfo {
+	info := &windowInfo{win: win}
+	pid, err := ewmh.GetWMPid(conn, win).Reply(conn)
+	if err == nil {
+		info.pid = int(pid)
+	}
+	info.wmClass, _ = icccm.GetWMClass(conn, win).Reply(conn)
+	reply, err := x.GetProperty(conn, false, win, atomStartupId,
+		x.GetPropertyTypeAny, 0, 256).Reply(conn)
+	if err == nil {
+		info.startupId = strings.TrimRight(string(reply.Value), "\x00")
+	}
+	return info
+}
+
+// watchWindows 使用单独的 X 连接监听 _NET_CLIENT_LIST 的变化，发现新窗口
+func (sn *startupNotifier) watchWindows() {
+	conn, err := x.NewConn()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	defer conn.Close()
+
+	root := conn.GetDefaultScreen().Root
+	err = x.ChangeWindowAttributesChecked(conn, root, x.CWEventMask, []uint32{
+		x.EventMaskPropertyChange}).Check(conn)
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	atomClientList, err := conn.GetAtom("_NET_CLIENT_LIST")
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	atomStartupId, err := conn.GetAtom("_NET_STARTUP_ID")
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	knownWindows := make(map[x.Window]bool)
+	clientList, err := ewmh.GetClientList(conn).Reply(conn)
+	if err == nil {
+		for _, win := range clientList {
+			knownWindows[win] = true
+		}
+	}
+
+	eventChan := make(chan x.GenericEvent, 10)
+	conn.AddEventChan(eventChan)
+	for ev := range eventChan {
+		if ev.GetEventCode() != x.PropertyNotifyEventCode {
+			continue
+		}
+		event, _ := x.NewPropertyNotifyEvent(ev)
+		if event.Atom != atomClientList || event.Window != root {
+			continue
+		}
+
+		clientList, err := ewmh.GetClientList(conn).Reply(conn)
+		if err != nil {
+			logger.Warning(err)
+			continue
+		}
+		windows := make(map[x.Window]bool, len(clientList))
+		for _, win := range clientList {
+			windows[win] = true
+			if !knownWindows[win] {
+				sn.handleNewWindow(getWindowInfo(conn, win, atomStartupId))
+			}
+		}
+		knownWindows = windows
+	}
+}
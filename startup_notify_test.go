@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/linuxdeepin/go-x11-client/util/wm/icccm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeStartupInfoMessage(t *testing.T) {
+	msg := makeStartupInfoMessage("new", []string{"ID", "NAME", "WMCLASS"},
+		map[string]string{"ID": "a_TIME1", "NAME": `say "hi" \o/`})
+	assert.Equal(t, `new: ID="a_TIME1" NAME="say \"hi\" \\o/"`, msg)
+
+	msg = makeStartupInfoMessage("remove", []string{"ID"}, map[string]string{"ID": "a_TIME1"})
+	assert.Equal(t, `remove: ID="a_TIME1"`, msg)
+}
+
+func TestSplitStartupInfoMessage(t *testing.T) {
+	msg := strings.Repeat("x", 39)
+	chunks := splitStartupInfoMessage(msg)
+	assert.Len(t, chunks, 2)
+	assert.Equal(t, byte(0), chunks[1][19])
+
+	chunks = splitStartupInfoMessage(strings.Repeat("x", 40))
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, make([]byte, 20), chunks[2])
+}
+
+func TestNewStartupId(t *testing.T) {
+	sn := newStartupNotifier(nil)
+	id := sn.newStartupId("deepin music", 100)
+	assert.True(t, strings.HasPrefix(id, "startdde-deepin_music-"))
+	assert.True(t, strings.HasSuffix(id, "-1_TIME100"))
+}
+
+func TestStartupSequenceMatchWindow(t *testing.T) {
+	seq := &startupSequence{id: "a_TIME1", wmClass: "deepin-music", pid: 10}
+	assert.True(t, seq.matchWindow(&windowInfo{startupId: "a_TIME1"}))
+	assert.False(t, seq.matchWindow(&windowInfo{startupId: "b_TIME1", pid: 10}))
+	assert.True(t, seq.matchWindow(&windowInfo{wmClass: icccm.WMClass{Class: "Deepin-music"}}))
+	assert.True(t, seq.matchWindow(&windowInfo{pid: 10}))
+	assert.False(t, seq.matchWindow(&windowInfo{pid: 11}))
+}
@@ -0,0 +1,408 @@
+package swapsched
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pkg.deepin.io/lib/cgroup"
+)
+
+const (
+	cgroupCpu  = "cpu"
+	cgroupPids = "pids"
+
+	// cpu.cfs_period_us 和 cpu.max 使用的周期
+	cpuPeriodUs = 100000
+
+	// 与 systemd 相同，CPUWeight 和 IOWeight 的默认值是 100
+	cgroupWeightDefault = 100
+	blkioWeightDefault  = 500
+	blkioWeightMin      = 10
+	blkioWeightMax      = 1000
+)
+
+// cgroupHandle 屏蔽 cgroup v1 和 v2(unified hierarchy) 的差异
+//
+// 在 v1 下 SetMemoryHigh 和 SetMemoryLow 都设置 memory.soft_limit_in_bytes，
+// 在 v2 下前者设置 memory.high 限制非活跃应用，后者设置 memory.low 保护活跃应用和 DE。
+type cgroupHandle interface {
+	Name() string
+	AllExist() bool
+	Create() error
+	Delete() error // 只删除空的 cgroup
+	NewChild(name string) cgroupHandle
+	AttachCurrentProcess() error
+	GetProcs() ([]int, error)
+	GetMemoryUsed() uint64
+	SetMemoryHigh(v uint64) error
+	SetMemoryLow(v uint64) error
+	CancelMemoryLimit() error
+	SetMemoryMax(v uint64) error
+	SetIOMax(device string, readBPS, writeBPS uint64) error
+	SetCPUQuota(percent uint64) error
+	SetCPUWeight(weight uint64) error
+	SetPidsMax(n uint64) error
+	SetIOWeight(weight uint64) error
+	Controllers() []string
+	Freeze() error
+	Thaw() error
+}
+
+// IsUnifiedCgroup 返回系统是否以 cgroup v2 (unified hierarchy) 启动
+func IsUnifiedCgroup() bool {
+	_, err := os.Stat(filepath.Join(SystemCGroupRoot, "cgroup.controllers"))
+	return err == nil
+}
+
+func newCgroupHandle(name string, controllers ...string) cgroupHandle {
+	if IsUnifiedCgroup() {
+		return newCgroupV2(SystemCGroupRoot, name)
+	}
+	return newCgroupV1(name, controllers...)
+}
+
+type cgroupV1 struct {
+	cg          *cgroup.Cgroup
+	controllers []string
+}
+
+func newCgroupV1(name string, controllers ...string) *cgroupV1 {
+	c := &cgroupV1{cg: cgroup.NewCgroup(name)}
+	for _, ctl := range controllers {
+		c.addController(ctl)
+	}
+	return c
+}
+
+func (c *cgroupV1) addController(name string) {
+	c.cg.AddController(name)
+	c.controllers = append(c.controllers, name)
+}
+
+// addOptionalControllers 添加已经为该 cgroup 创建了目录的控制器，
+// v1 下 cpu 和 pids 组不一定由 SwapSchedHelper 创建
+func (c *cgroupV1) addOptionalControllers(names ...string) {
+	for _, name := range names {
+		_, err := os.Stat(filepath.Join(SystemCGroupRoot, name, c.cg.Name()))
+		if err == nil {
+			c.addController(name)
+		}
+	}
+}
+
+func (c *cgroupV1) hasController(name string) bool {
+	for _, ctl := range c.controllers {
+		if ctl == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cgroupV1) getController(name string) (*cgroup.Controller, error) {
+	if !c.hasController(name) {
+		return nil, fmt.Errorf("cgroup controller %s is not available", name)
+	}
+	return c.cg.GetController(name), nil
+}
+
+func (c *cgroupV1) Name() string {
+	return c.cg.Name()
+}
+
+func (c *cgroupV1) AllExist() bool {
+	return c.cg.AllExist()
+}
+
+func (c *cgroupV1) Create() error {
+	return c.cg.Create(false)
+}
+
+func (c *cgroupV1) Delete() error {
+	return c.cg.Delete(cgroup.DeleteFlagEmptyOnly)
+}
+
+func (c *cgroupV1) NewChild(name string) cgroupHandle {
+	return &cgroupV1{cg: c.cg.NewChildGroup(name), controllers: c.controllers}
+}
+
+func (c *cgroupV1) AttachCurrentProcess() error {
+	return c.cg.AttachCurrentProcess()
+}
+
+func (c *cgroupV1) GetProcs() ([]int, error) {
+	return c.cg.GetProcs(cgroup.Memory)
+}
+
+func (c *cgroupV1) GetMemoryUsed() uint64 {
+	return getRSSUsed(c.cg.GetController(cgroup.Memory))
+}
+
+func (c *cgroupV1) SetMemoryHigh(v uint64) error {
+	return setSoftLimit(c.cg.GetController(cgroup.Memory), v)
+}
+
+func (c *cgroupV1) SetMemoryLow(v uint64) error {
+	return setSoftLimit(c.cg.GetController(cgroup.Memory), v)
+}
+
+func (c *cgroupV1) CancelMemoryLimit() error {
+	return cancelSoftLimit(c.cg.GetController(cgroup.Memory))
+}
+
+func (c *cgroupV1) SetMemoryMax(v uint64) error {
+	return setHardLimit(c.cg.GetController(cgroup.Memory), v)
+}
+
+func (c *cgroupV1) SetIOMax(device string, readBPS, writeBPS uint64) error {
+	blkioCtl := c.cg.GetController(cgroup.Blkio)
+	if readBPS > 0 {
+		err := setReadBPS(blkioCtl, device, readBPS)
+		if err != nil {
+			return err
+		}
+	}
+	if writeBPS > 0 {
+		return setWriteBPS(blkioCtl, device, writeBPS)
+	}
+	return nil
+}
+
+func (c *cgroupV1) SetCPUQuota(percent uint64) error {
+	cpuCtl, err := c.getController(cgroupCpu)
+	if err != nil {
+		return err
+	}
+	err = cpuCtl.SetValueUint64("cfs_period_us", cpuPeriodUs)
+	if err != nil {
+		return err
+	}
+	return cpuCtl.SetValueUint64("cfs_quota_us", percent*cpuPeriodUs/100)
+}
+
+func (c *cgroupV1) SetCPUWeight(weight uint64) error {
+	cpuCtl, err := c.getController(cgroupCpu)
+	if err != nil {
+		return err
+	}
+	return cpuCtl.SetValueUint64("shares", getCPUShares(weight))
+}
+
+func (c *cgroupV1) SetPidsMax(n uint64) error {
+	pidsCtl, err := c.getController(cgroupPids)
+	if err != nil {
+		return err
+	}
+	return pidsCtl.SetValueUint64("max", n)
+}
+
+func (c *cgroupV1) SetIOWeight(weight uint64) error {
+	blkioCtl, err := c.getController(cgroup.Blkio)
+	if err != nil {
+		return err
+	}
+	return blkioCtl.SetValueUint64("weight", getBlkioWeight(weight))
+}
+
+func (c *cgroupV1) Controllers() []string {
+	return c.controllers
+}
+
+func (c *cgroupV1) Freeze() error {
+	return c.cg.GetController(cgroup.Freezer).SetValueString("state", "FROZEN")
+}
+
+func (c *cgroupV1) Thaw() error {
+	return c.cg.GetController(cgroup.Freezer).SetValueString("state", "THAWED")
+}
+
+type cgroupV2 struct {
+	root string
+	name string
+}
+
+func newCgroupV2(root, name string) *cgroupV2 {
+	return &cgroupV2{root: root, name: name}
+}
+
+func (c *cgroupV2) path(file string) string {
+	return filepath.Join(c.root, c.name, file)
+}
+
+func (c *cgroupV2) readFile(file string) (string, error) {
+	data, err := ioutil.ReadFile(c.path(file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (c *cgroupV2) writeFile(file, value string) error {
+	return ioutil.WriteFile(c.path(file), []byte(value), 0644)
+}
+
+func (c *cgroupV2) Name() string {
+	return c.name
+}
+
+func (c *cgroupV2) AllExist() bool {
+	_, err := os.Stat(c.path("memory.high"))
+	return err == nil
+}
+
+func (c *cgroupV2) Create() error {
+	err := os.Mkdir(c.path(""), 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *cgroupV2) Delete() error {
+	return os.Remove(c.path(""))
+}
+
+func (c *cgroupV2) NewChild(name string) cgroupHandle {
+	return newCgroupV2(c.root, filepath.Join(c.name, name))
+}
+
+// enableSubtreeControllers 使子 cgroup 可以使用 memory、io、cpu 和 pids 控制器，
+// 逐个启用以免一个控制器不可用时其他控制器也无法启用
+func (c *cgroupV2) enableSubtreeControllers() error {
+	var lastErr error
+	for _, ctl := range []string{"memory", "io", cgroupCpu, cgroupPids} {
+		err := c.writeFile("cgroup.subtree_control", "+"+ctl)
+		if err != nil {
+			lastErr = fmt.Errorf("enable %s: %v", ctl, err)
+		}
+	}
+	return lastErr
+}
+
+func (c *cgroupV2) AttachCurrentProcess() error {
+	return c.writeFile("cgroup.procs", strconv.Itoa(os.Getpid()))
+}
+
+func (c *cgroupV2) GetProcs() ([]int, error) {
+	content, err := c.readFile("cgroup.procs")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, line := range strings.Fields(content) {
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func (c *cgroupV2) GetMemoryUsed() uint64 {
+	content, err := c.readFile("memory.current")
+	if err != nil {
+		logger.Warning(err)
+		return 0
+	}
+	v, err := strconv.ParseUint(content, 10, 64)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return v
+}
+
+func (c *cgroupV2) SetMemoryHigh(v uint64) error {
+	return c.writeFile("memory.high", strconv.FormatUint(v, 10))
+}
+
+func (c *cgroupV2) SetMemoryLow(v uint64) error {
+	return c.writeFile("memory.low", strconv.FormatUint(v, 10))
+}
+
+func (c *cgroupV2) CancelMemoryLimit() error {
+	err := c.writeFile("memory.high", "max")
+	if err != nil {
+		return err
+	}
+	return c.writeFile("memory.low", "0")
+}
+
+func (c *cgroupV2) SetMemoryMax(v uint64) error {
+	return c.writeFile("memory.max", strconv.FormatUint(v, 10))
+}
+
+func (c *cgroupV2) SetIOMax(device string, readBPS, writeBPS uint64) error {
+	if readBPS == 0 && writeBPS == 0 {
+		return nil
+	}
+	value := device
+	if readBPS > 0 {
+		value += fmt.Sprintf(" rbps=%d", readBPS)
+	}
+	if writeBPS > 0 {
+		value += fmt.Sprintf(" wbps=%d", writeBPS)
+	}
+	return c.writeFile("io.max", value)
+}
+
+func (c *cgroupV2) SetCPUQuota(percent uint64) error {
+	return c.writeFile("cpu.max", fmt.Sprintf("%d %d", percent*cpuPeriodUs/100, cpuPeriodUs))
+}
+
+func (c *cgroupV2) SetCPUWeight(weight uint64) error {
+	return c.writeFile("cpu.weight", strconv.FormatUint(weight, 10))
+}
+
+func (c *cgroupV2) SetPidsMax(n uint64) error {
+	return c.writeFile("pids.max", strconv.FormatUint(n, 10))
+}
+
+func (c *cgroupV2) SetIOWeight(weight uint64) error {
+	return c.writeFile("io.weight", "default "+strconv.FormatUint(weight, 10))
+}
+
+// Controllers 在 v2 下没有意义，进程移入 cgroup 时不需要指定控制器
+func (c *cgroupV2) Controllers() []string {
+	return nil
+}
+
+func (c *cgroupV2) Freeze() error {
+	return c.writeFile("cgroup.freeze", "1")
+}
+
+func (c *cgroupV2) Thaw() error {
+	return c.writeFile("cgroup.freeze", "0")
+}
+
+// getCPUShares 把 CPUWeight 换算为 v1 的 cpu.shares，与 systemd 的换算方法相同
+func getCPUShares(weight uint64) uint64 {
+	shares := weight * 1024 / cgroupWeightDefault
+	if shares < 2 {
+		shares = 2
+	}
+	return shares
+}
+
+// getBlkioWeight 把 IOWeight 换算为 v1 的 blkio.weight，与 systemd 的换算方法相同
+func getBlkioWeight(weight uint64) uint64 {
+	v := weight * blkioWeightDefault / cgroupWeightDefault
+	if v < blkioWeightMin {
+		v = blkioWeightMin
+	} else if v > blkioWeightMax {
+		v = blkioWeightMax
+	}
+	return v
+}
+
+// GetCgroupProcsFile 返回 cgroup 的 cgroup.procs 文件，用于在启动命令前把进程移入 cgroup
+func GetCgroupProcsFile(name string) string {
+	if IsUnifiedCgroup() {
+		return filepath.Join(SystemCGroupRoot, name, "cgroup.procs")
+	}
+	return filepath.Join(SystemCGroupRoot, "memory", name, "cgroup.procs")
+}
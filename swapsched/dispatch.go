@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -55,24 +57,32 @@ type Dispatcher struct {
 	activeXID int
 	enabled   bool
 
-	uiAppsCg     *cgroup.Cgroup
+	uiAppsCg     cgroupHandle
 	activeApp    *UIApp
 	inactiveApps []*UIApp
 
-	deCg *cgroup.Cgroup
+	deCg cgroupHandle
 }
 
 func NewDispatcher(cfg Config) (*Dispatcher, error) {
 	if cfg.SamplePeroid <= 0 {
 		cfg.SamplePeroid = DefaultSamplePeriod
 	}
-	deCg := cgroup.NewCgroup(cfg.DECGroup)
-	deCg.AddController(cgroup.Memory)
-
-	uiAppsCg := cgroup.NewCgroup(cfg.UIAppsCGroup)
-	uiAppsCg.AddController(cgroup.Freezer)
-	uiAppsCg.AddController(cgroup.Memory)
-	uiAppsCg.AddController(cgroup.Blkio)
+	deCg := newCgroupHandle(cfg.DECGroup, cgroup.Memory)
+	uiAppsCg := newCgroupHandle(cfg.UIAppsCGroup, cgroup.Freezer, cgroup.Memory, cgroup.Blkio)
+	if uiAppsV2, ok := uiAppsCg.(*cgroupV2); ok {
+		// v2 下子 cgroup 只能使用父 cgroup 启用的控制器，
+		// 需要先在 <uid>@dde 中启用，uiapps 才能为应用的 cgroup 启用
+		parent := newCgroupV2(uiAppsV2.root, filepath.Dir(uiAppsV2.name))
+		for _, c := range []*cgroupV2{parent, uiAppsV2} {
+			err := c.enableSubtreeControllers()
+			if err != nil {
+				logger.Warningf("failed to enable controllers for cgroup %s: %v", c.name, err)
+			}
+		}
+	} else if uiAppsV1, ok := uiAppsCg.(*cgroupV1); ok {
+		uiAppsV1.addOptionalControllers(cgroupCpu, cgroupPids)
+	}
 
 	d := &Dispatcher{
 		cfg:       cfg,
@@ -97,6 +107,11 @@ func (d *Dispatcher) GetDECGroup() string {
 	return d.cfg.DECGroup
 }
 
+// AttachCurrentProcessToDE 把当前进程移入 DE 组
+func (d *Dispatcher) AttachCurrentProcessToDE() error {
+	return d.deCg.AttachCurrentProcess()
+}
+
 func (d *Dispatcher) counter() uint32 {
 	d.Lock()
 	d.cnt++
@@ -105,15 +120,24 @@ func (d *Dispatcher) counter() uint32 {
 	return result
 }
 
+// AppCGroupControllers 返回 NewApp 创建的 cgroup 的 cgexec 控制器列表
+func (d *Dispatcher) AppCGroupControllers() string {
+	return strings.Join(d.uiAppsCg.Controllers(), ",")
+}
+
 type AppResourcesLimit struct {
 	MemHardLimit  uint64
 	BlkioReadBPS  uint64
 	BlkioWriteBPS uint64
+	CPUQuota      uint64 // 百分比，100 表示一个 CPU 的全部时间
+	CPUWeight     uint64 // 1~10000，默认为 100
+	MaxTasks      uint64
+	IOWeight      uint64 // 1~10000，默认为 100
 }
 
 func (d *Dispatcher) NewApp(desc string, limit *AppResourcesLimit) (*UIApp, error) {
 	seqNum := d.counter()
-	appCg := d.uiAppsCg.NewChildGroup(strconv.FormatUint(uint64(seqNum), 10))
+	appCg := d.uiAppsCg.NewChild(strconv.FormatUint(uint64(seqNum), 10))
 	app, err := newApp(seqNum, appCg, desc, limit)
 	if err != nil {
 		return nil, err
@@ -214,8 +238,7 @@ func (d *Dispatcher) cancelLimit() {
 	logger.Debug("cancel limit")
 
 	var err error
-	appsMemCtl := d.uiAppsCg.GetController(cgroup.Memory)
-	err = cancelSoftLimit(appsMemCtl)
+	err = d.uiAppsCg.CancelMemoryLimit()
 	if err != nil {
 		logger.Warning("failed to cancel soft limit for uiapps cgroup:", err)
 	}
@@ -234,8 +257,7 @@ func (d *Dispatcher) cancelLimit() {
 		}
 	}
 
-	deMemCtl := d.deCg.GetController(cgroup.Memory)
-	err = cancelSoftLimit(deMemCtl)
+	err = d.deCg.CancelMemoryLimit()
 	if err != nil {
 		logger.Warning("failed to cancel soft limit for DE cgroup:", err)
 	}
@@ -281,27 +303,25 @@ func (d *Dispatcher) balance() {
 	}
 
 	// apply limit
-	appsFreezerCtl := d.uiAppsCg.GetController(cgroup.Freezer)
-	err := appsFreezerCtl.SetValueString("state", "FROZEN")
+	err := d.uiAppsCg.Freeze()
 	if err != nil {
 		logger.Warning(err)
 	} else {
 		defer func() {
-			err := appsFreezerCtl.SetValueString("state", "THAWED")
+			err := d.uiAppsCg.Thaw()
 			if err != nil {
 				logger.Warning(err)
 			}
 		}()
 	}
 
-	appsMemCtl := d.uiAppsCg.GetController(cgroup.Memory)
-	err = setSoftLimit(appsMemCtl, info.TailorLimit(info.UIAppsTotalLimit()))
+	err = d.uiAppsCg.SetMemoryHigh(info.TailorLimit(info.UIAppsTotalLimit()))
 	if err != nil {
 		logger.Warning("failed to set soft limit for uiapps cgroup:", err)
 	}
 
 	if d.activeApp != nil {
-		err = d.activeApp.SetLimitRSS(info.TailorLimit(info.ActiveAppLimit()))
+		err = d.activeApp.setActiveLimitRSS(info.TailorLimit(info.ActiveAppLimit()))
 		if err != nil {
 			logger.Warningf("failed to set soft limit for active %s: %v ", d.activeApp, err)
 		}
@@ -314,8 +334,7 @@ func (d *Dispatcher) balance() {
 		}
 	}
 
-	deMemCtl := d.deCg.GetController(cgroup.Memory)
-	err = setSoftLimit(deMemCtl, DESoftLimit)
+	err = d.deCg.SetMemoryLow(DESoftLimit)
 	if err != nil {
 		logger.Warning("failed to set soft limit for DE cgroup:", err)
 	}
@@ -352,6 +371,23 @@ func (d *Dispatcher) GetAppsSeqDescMap() map[uint32]string {
 	return ret
 }
 
+// GetAppPids 返回描述为 desc 的存活应用 cgroup 中的进程
+func (d *Dispatcher) GetAppPids(desc string) []int {
+	d.Lock()
+	defer d.Unlock()
+
+	var pids []int
+	if d.activeApp != nil && d.activeApp.desc == desc && d.activeApp.IsLive() {
+		pids = append(pids, d.activeApp.pids...)
+	}
+	for _, app := range d.inactiveApps {
+		if app.desc == desc && app.IsLive() {
+			pids = append(pids, app.pids...)
+		}
+	}
+	return pids
+}
+
 type MemInfo struct {
 	TotalRAM      uint64 //　物理内存总大小
 	TotalRSSFree  uint64 //当前一共可用的物理内存
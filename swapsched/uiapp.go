@@ -1,14 +1,13 @@
 package swapsched
 
 import (
+	"strings"
 	"sync"
-
-	"pkg.deepin.io/lib/cgroup"
 )
 
 type UIApp struct {
 	seqNum uint32
-	cg     *cgroup.Cgroup
+	cg     cgroupHandle
 	limit  uint64
 	desc   string
 	mu     sync.Mutex
@@ -35,6 +34,11 @@ func (app *UIApp) GetCGroup() string {
 	return app.cg.Name()
 }
 
+// GetCGroupControllers 返回 cgexec 使用的控制器列表，如 memory,freezer,blkio
+func (app *UIApp) GetCGroupControllers() string {
+	return strings.Join(app.cg.Controllers(), ",")
+}
+
 func (app *UIApp) HasChild(pid int) bool {
 	for _, pid0 := range app.pids {
 		if pid0 == pid {
@@ -47,12 +51,11 @@ func (app *UIApp) HasChild(pid int) bool {
 // Update 更新 rssUsed以及pids字段, 若len(pids)为0, 则尝试释放此uiapp
 func (app *UIApp) Update() {
 	app.updatePids()
-	ctl := app.cg.GetController(cgroup.Memory)
-	app.rssUsed = getRSSUsed(ctl)
+	app.rssUsed = app.cg.GetMemoryUsed()
 }
 
 func (app *UIApp) updatePids() {
-	app.pids, _ = app.cg.GetProcs(cgroup.Memory)
+	app.pids, _ = app.cg.GetProcs()
 	if len(app.pids) == 0 {
 		app.maybeDestroy()
 	}
@@ -63,13 +66,29 @@ func (app *UIApp) SetLimitRSS(v uint64) error {
 		return nil
 	}
 	app.limit = v
-	ctl := app.cg.GetController(cgroup.Memory)
-	return setSoftLimit(ctl, v)
+	// 清除作为活跃应用时设置的 memory.low
+	err := app.cg.CancelMemoryLimit()
+	if err != nil {
+		return err
+	}
+	return app.cg.SetMemoryHigh(v)
+}
+
+// setActiveLimitRSS 设置活跃应用的限制，在 cgroup v2 下使用 memory.low 保护其内存
+func (app *UIApp) setActiveLimitRSS(v uint64) error {
+	if !app.IsLive() {
+		return nil
+	}
+	app.limit = v
+	err := app.cg.CancelMemoryLimit()
+	if err != nil {
+		return err
+	}
+	return app.cg.SetMemoryLow(v)
 }
 
 func (app *UIApp) cancelLimitRSS() error {
-	ctl := app.cg.GetController(cgroup.Memory)
-	return cancelSoftLimit(ctl)
+	return app.cg.CancelMemoryLimit()
 }
 
 // 设置的CGroup Soft Limit值
@@ -107,53 +126,69 @@ func (app *UIApp) maybeDestroy() {
 	app.mu.Unlock()
 	logger.Debug("dead", app)
 
-	err := app.cg.Delete(cgroup.DeleteFlagEmptyOnly)
+	err := app.cg.Delete()
 	if err != nil {
 		logger.Warningf("failed to delete cgroup for %s: %v", app, err)
 	}
 }
 
-func newApp(seqNum uint32, cg *cgroup.Cgroup, desc string,
+func newApp(seqNum uint32, cg cgroupHandle, desc string,
 	limit *AppResourcesLimit) (*UIApp, error) {
 
-	err := cg.Create(false)
+	err := cg.Create()
 	if err != nil {
 		return nil, err
 	}
 
 	if limit != nil {
 		if limit.MemHardLimit > 0 {
-			memCtl := cg.GetController(cgroup.Memory)
-			err = setHardLimit(memCtl, limit.MemHardLimit)
+			err = cg.SetMemoryMax(limit.MemHardLimit)
 			if err != nil {
 				logger.Warning("failed to set hard limit:", err)
 			}
 		}
 
 		if limit.BlkioReadBPS > 0 || limit.BlkioWriteBPS > 0 {
-			blkioCtl := cg.GetController(cgroup.Blkio)
-
 			var homeDevice string
 			homeDevice, err = getHomeDirBlockDevice()
 			if err == nil {
-				if limit.BlkioReadBPS > 0 {
-					err = setReadBPS(blkioCtl, homeDevice, limit.BlkioReadBPS)
-					if err != nil {
-						logger.Warning("failed to set read BPS:", err)
-					}
-				}
-
-				if limit.BlkioWriteBPS > 0 {
-					err = setWriteBPS(blkioCtl, homeDevice, limit.BlkioWriteBPS)
-					if err != nil {
-						logger.Warning("failed to set write BPS:", err)
-					}
+				err = cg.SetIOMax(homeDevice, limit.BlkioReadBPS, limit.BlkioWriteBPS)
+				if err != nil {
+					logger.Warning("failed to set io max:", err)
 				}
 			} else {
 				logger.Warning("failed to get home dir block device:", err)
 			}
 
 		}
+
+		if limit.CPUQuota > 0 {
+			err = cg.SetCPUQuota(limit.CPUQuota)
+			if err != nil {
+				logger.Warning("failed to set cpu quota:", err)
+			}
+		}
+
+		if limit.CPUWeight > 0 {
+			err = cg.SetCPUWeight(limit.CPUWeight)
+			if err != nil {
+				logger.Warning("failed to set cpu weight:", err)
+			}
+		}
+
+		if limit.MaxTasks > 0 {
+			err = cg.SetPidsMax(limit.MaxTasks)
+			if err != nil {
+				logger.Warning("failed to set pids max:", err)
+			}
+		}
+
+		if limit.IOWeight > 0 {
+			err = cg.SetIOWeight(limit.IOWeight)
+			if err != nil {
+				logger.Warning("failed to set io weight:", err)
+			}
+		}
 	}
 
 	return &UIApp{
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const (
+	gKeyLaunchBackend = "launch-backend"
+
+	launchBackendCgexec  = "cgexec"
+	launchBackendSystemd = "systemd"
+
+	systemdDest             = "org.freedesktop.systemd1"
+	systemdObjPath          = "/org/freedesktop/systemd1"
+	systemdManagerIfc       = systemdDest + ".Manager"
+	systemdUnitIfc          = systemdDest + ".Unit"
+	systemdScopeIfc         = systemdDest + ".Scope"
+	appScopeSlice           = "app.slice"
+	appScopeNamePrefix      = "app-dde-"
+	appScopeNameSuffix      = ".scope"
+	appScopeCollectInactive = "inactive-or-failed"
+
+	// getScopeWaitPrefix 每 10ms 检查一次，最多等待 1s
+	appScopeWaitTries = 100
+
+	// scope 中的进程被 OOM killer 杀死时单元的 Result
+	scopeResultOOMKill = "oom-kill"
+)
+
+type systemdUnitProperty struct {
+	Name  string
+	Value dbus.Variant
+}
+
+type systemdAuxUnit struct {
+	Name       string
+	Properties []systemdUnitProperty
+}
+
+type systemdIOBandwidth struct {
+	Path      string
+	Bandwidth uint64
+}
+
+var _appScopeSeq uint32
+
+func useSystemdScope() bool {
+	return _gSettingsConfig != nil && _gSettingsConfig.launchBackend == launchBackendSystemd
+}
+
+// escapeUnitNamePart 按 systemd 的规则转义单元名中不允许出现的字符
+func escapeUnitNamePart(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == ':', c == '_', c == '-', c == '.' && i > 0:
+			sb.WriteByte(c)
+		case c == '/':
+			sb.WriteByte('-')
+		default:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		}
+	}
+	return sb.String()
+}
+
+func getAppScopeName(id string, seq uint32) string {
+	return fmt.Sprintf("%s%s-%d%s", appScopeNamePrefix, escapeUnitNamePart(id), seq, appScopeNameSuffix)
+}
+
+func getAppScopeProperties(desc string, pid int, limit *swapsched.AppResourcesLimit) []systemdUnitProperty {
+	props := []systemdUnitProperty{
+		{Name: "Description", Value: dbus.MakeVariant(desc)},
+		{Name: "Slice", Value: dbus.MakeVariant(appScopeSlice)},
+		{Name: "CollectMode", Value: dbus.MakeVariant(appScopeCollectInactive)},
+		{Name: "PIDs", Value: dbus.MakeVariant([]uint32{uint32(pid)})},
+	}
+	if limit == nil {
+		return props
+	}
+
+	if limit.MemHardLimit > 0 {
+		props = append(props, systemdUnitProperty{Name: "MemoryMax",
+			Value: dbus.MakeVariant(limit.MemHardLimit)})
+	}
+	// 使用家目录路径，由 systemd 找到其所在的块设备
+	homeDir := basedir.GetUserHomeDir()
+	if limit.BlkioReadBPS > 0 {
+		props = append(props, systemdUnitProperty{Name: "IOReadBandwidthMax",
+			Value: dbus.MakeVariant([]systemdIOBandwidth{{homeDir, limit.BlkioReadBPS}})})
+	}
+	if limit.BlkioWriteBPS > 0 {
+		props = append(props, systemdUnitProperty{Name: "IOWriteBandwidthMax",
+			Value: dbus.MakeVariant([]systemdIOBandwidth{{homeDir, limit.BlkioWriteBPS}})})
+	}
+	if limit.CPUQuota > 0 {
+		// CPUQuotaPerSecUSec 是每秒可使用的 CPU 时间，单位为微秒
+		props = append(props, systemdUnitProperty{Name: "CPUQuotaPerSecUSec",
+			Value: dbus.MakeVariant(limit.CPUQuota * 10000)})
+	}
+	if limit.CPUWeight > 0 {
+		props = append(props, systemdUnitProperty{Name: "CPUWeight",
+			Value: dbus.MakeVariant(limit.CPUWeight)})
+	}
+	if limit.MaxTasks > 0 {
+		props = append(props, systemdUnitProperty{Name: "TasksMax",
+			Value: dbus.MakeVariant(limit.MaxTasks)})
+	}
+	if limit.IOWeight > 0 {
+		props = append(props, systemdUnitProperty{Name: "IOWeight",
+			Value: dbus.MakeVariant(limit.IOWeight)})
+	}
+	return props
+}
+
+// newAppScopeName 为一次启动分配 scope 单元名
+func newAppScopeName(id string) string {
+	return getAppScopeName(id, atomic.AddUint32(&_appScopeSeq, 1))
+}
+
+// getScopeWaitPrefix 返回等待 shell 被移入 scope 后再运行命令的命令前缀，
+// 进程在启动之后才被移入 scope，这样命令和它的子进程都在 scope 中运行，
+// scope 创建失败时等待超时后仍然运行命令
+func getScopeWaitPrefix(scope string) []string {
+	script := fmt.Sprintf(`i=0; until grep -qF %s /proc/$$/cgroup; do `+
+		`i=$((i+1)); [ $i -ge %d ] && break; sleep 0.01; done; exec "$@"`,
+		shellQuote("/"+scope), appScopeWaitTries)
+	return []string{"/bin/sh", "-c", script, "sh"}
+}
+
+// startAppScope 请求 systemd --user 创建名为 name 的 transient scope 并把 pid 移入其中，
+// 返回的 appScopeUnit 引用了单元，需要调用 release 释放
+func startAppScope(name, desc string, pid int, limit *swapsched.AppResourcesLimit) (*appScopeUnit, error) {
+	sessionBus, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	props := getAppScopeProperties(desc, pid, limit)
+	logger.Debugf("start transient unit %s, properties: %v", name, props)
+
+	systemdUser := sessionBus.Object(systemdDest, systemdObjPath)
+	var jobPath dbus.ObjectPath
+	err = systemdUser.Call(systemdManagerIfc+".StartTransientUnit", dbus.FlagNoAutoStart,
+		name, "fail", props, []systemdAuxUnit{}).Store(&jobPath)
+	if err != nil {
+		return nil, err
+	}
+
+	unit, err := refAppScope(sessionBus, name)
+	if err != nil {
+		// 只影响 OOM 的检测
+		logger.Warningf("failed to ref unit %s: %v", name, err)
+	}
+	return unit, nil
+}
+
+// appScopeUnit 是被引用的 scope 单元，单元使用 CollectMode=inactive-or-failed，
+// 不引用的话进程退出后单元立即被回收，无法读取 Result
+type appScopeUnit struct {
+	obj dbus.BusObject
+}
+
+func refAppScope(conn *dbus.Conn, name string) (*appScopeUnit, error) {
+	systemdUser := conn.Object(systemdDest, systemdObjPath)
+	var unitPath dbus.ObjectPath
+	err := systemdUser.Call(systemdManagerIfc+".GetUnit", dbus.FlagNoAutoStart, name).Store(&unitPath)
+	if err != nil {
+		return nil, err
+	}
+	obj := conn.Object(systemdDest, unitPath)
+	err = obj.Call(systemdUnitIfc+".Ref", dbus.FlagNoAutoStart).Err
+	if err != nil {
+		return nil, err
+	}
+	return &appScopeUnit{obj: obj}, nil
+}
+
+// release 返回单元的 Result 并释放引用，进程被 OOM killer 杀死时 Result 为 oom-kill
+func (u *appScopeUnit) release() (string, error) {
+	v, err := u.obj.GetProperty(systemdScopeIfc + ".Result")
+	unrefErr := u.obj.Call(systemdUnitIfc+".Unref", dbus.FlagNoAutoStart).Err
+	if unrefErr != nil {
+		logger.Warning("failed to unref unit:", unrefErr)
+	}
+	if err != nil {
+		return "", err
+	}
+	result, ok := v.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected type of Result: %s", v.Signature())
+	}
+	return result, nil
+}
+
+// getScopeId 返回用于 scope 单元名的 id，desktop 文件使用 app id，命令使用可执行文件名
+func getScopeId(appId, desktopFile string) string {
+	if appId != "" {
+		return appId
+	}
+	return strings.TrimSuffix(filepath.Base(desktopFile), desktopExt)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"pkg.deepin.io/dde/startdde/swapsched"
+)
+
+func TestGetAppScopeName(t *testing.T) {
+	assert.Equal(t, "app-dde-deepin-music-1.scope", getAppScopeName("deepin-music", 1))
+	assert.Equal(t, `app-dde-org.gnome.Terminal-2.scope`, getAppScopeName("org.gnome.Terminal", 2))
+	assert.Equal(t, `app-dde-a\x20b-3.scope`, getAppScopeName("a b", 3))
+	assert.Equal(t, `app-dde-\x2ehidden-4.scope`, getAppScopeName(".hidden", 4))
+}
+
+func TestGetScopeId(t *testing.T) {
+	assert.Equal(t, "deepin-music", getScopeId("deepin-music", "/usr/share/applications/deepin-music.desktop"))
+	assert.Equal(t, "foo", getScopeId("", "/opt/apps/foo.desktop"))
+	assert.Equal(t, "ls", getScopeId("", "/bin/ls"))
+}
+
+func TestGetAppScopeProperties(t *testing.T) {
+	props := getAppScopeProperties("Music", 100, nil)
+	names := make([]string, 0, len(props))
+	for _, prop := range props {
+		names = append(names, prop.Name)
+	}
+	assert.Equal(t, []string{"Description", "Slice", "CollectMode", "PIDs"}, names)
+	assert.Equal(t, []uint32{100}, props[3].Value.Value())
+
+	props = getAppScopeProperties("Music", 100, &swapsched.AppResourcesLimit{
+		MemHardLimit: 100e6,
+		BlkioReadBPS: 10e6,
+	})
+	assert.Len(t, props, 6)
+	assert.Equal(t, "MemoryMax", props[4].Name)
+	assert.Equal(t, uint64(100e6), props[4].Value.Value())
+	assert.Equal(t, "IOReadBandwidthMax", props[5].Name)
+
+	props = getAppScopeProperties("Make", 100, &swapsched.AppResourcesLimit{
+		CPUQuota:  150,
+		CPUWeight: 20,
+		MaxTasks:  256,
+		IOWeight:  10,
+	})
+	assert.Len(t, props, 8)
+	assert.Equal(t, "CPUQuotaPerSecUSec", props[4].Name)
+	assert.Equal(t, uint64(1500000), props[4].Value.Value())
+	assert.Equal(t, "CPUWeight", props[5].Name)
+	assert.Equal(t, "TasksMax", props[6].Name)
+	assert.Equal(t, uint64(256), props[6].Value.Value())
+	assert.Equal(t, "IOWeight", props[7].Name)
+}
+
+func TestGetScopeWaitPrefix(t *testing.T) {
+	prefix := getScopeWaitPrefix(`app-dde-a\x20b-3.scope`)
+	assert.Len(t, prefix, 4)
+	assert.Equal(t, []string{"/bin/sh", "-c"}, prefix[:2])
+	assert.Contains(t, prefix[2], `grep -qF '/app-dde-a\x20b-3.scope' /proc/$$/cgroup`)
+	assert.Contains(t, prefix[2], `exec "$@"`)
+	assert.Equal(t, "sh", prefix[3])
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+
+	"pkg.deepin.io/gir/gio-2.0"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+const (
+	KeyTerminal = "Terminal"
+
+	gKeyTerminal = "terminal"
+)
+
+// 用户没有设置终端或设置的终端不存在时依次尝试
+var fallbackTerminals = []string{"deepin-terminal", "x-terminal-emulator", "xterm"}
+
+// 各终端用于执行命令的参数，命令和它的参数跟在后面，不在表中的终端使用 -e
+var terminalExecArgs = map[string][]string{
+	"gnome-terminal": {"--"},
+	"mate-terminal":  {"-x"},
+	"xfce4-terminal": {"-x"},
+	"terminator":     {"-x"},
+}
+
+func needTerminal(appInfo *desktopappinfo.DesktopAppInfo) bool {
+	v, _ := appInfo.GetBool(desktopappinfo.MainSection, KeyTerminal)
+	return v
+}
+
+func getTerminalExecArgs(terminal string) []string {
+	if args, ok := terminalExecArgs[filepath.Base(terminal)]; ok {
+		return args
+	}
+	return []string{"-e"}
+}
+
+// findTerminal 返回第一个可用的终端，preferred 为空时只尝试 fallbackTerminals
+func findTerminal(preferred string, lookPath func(string) (string, error)) (string, error) {
+	candidates := fallbackTerminals
+	if preferred != "" {
+		candidates = append([]string{preferred}, fallbackTerminals...)
+	}
+	for _, terminal := range candidates {
+		path, err := lookPath(terminal)
+		if err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no terminal emulator found")
+}
+
+func getPreferredTerminal() string {
+	gs := gio.NewSettings("com.deepin.dde.startdde")
+	defer gs.Unref()
+	if !hasGSettingsKey(gs, gKeyTerminal) {
+		return ""
+	}
+	return gs.GetString(gKeyTerminal)
+}
+
+// getTerminalCmdPrefix 返回在终端中运行命令的命令前缀
+func getTerminalCmdPrefix() ([]string, error) {
+	terminal, err := findTerminal(getPreferredTerminal(), exec.LookPath)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{terminal}, getTerminalExecArgs(terminal)...), nil
+}
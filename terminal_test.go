@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTerminalExecArgs(t *testing.T) {
+	assert.Equal(t, []string{"--"}, getTerminalExecArgs("/usr/bin/gnome-terminal"))
+	assert.Equal(t, []string{"-x"}, getTerminalExecArgs("xfce4-terminal"))
+	assert.Equal(t, []string{"-e"}, getTerminalExecArgs("/usr/bin/deepin-terminal"))
+	assert.Equal(t, []string{"-e"}, getTerminalExecArgs("xterm"))
+}
+
+func TestFindTerminal(t *testing.T) {
+	installed := map[string]bool{"x-terminal-emulator": true, "xterm": true, "konsole": true}
+	lookPath := func(file string) (string, error) {
+		if installed[file] {
+			return "/usr/bin/" + file, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	terminal, err := findTerminal("konsole", lookPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/bin/konsole", terminal)
+
+	terminal, err = findTerminal("tilix", lookPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/bin/x-terminal-emulator", terminal)
+
+	terminal, err = findTerminal("", lookPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/bin/x-terminal-emulator", terminal)
+
+	_, err = findTerminal("", func(string) (string, error) {
+		return "", errors.New("not found")
+	})
+	assert.NotNil(t, err)
+}
@@ -30,9 +30,11 @@ import (
 	"time"
 
 	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/swapsched"
 	"pkg.deepin.io/gir/gio-2.0"
 	"pkg.deepin.io/lib/appinfo/desktopappinfo"
 	"pkg.deepin.io/lib/keyfile"
+	"pkg.deepin.io/lib/strv"
 	"pkg.deepin.io/lib/xdg/basedir"
 )
 
@@ -216,6 +218,9 @@ type GSettingsConfig struct {
 	swapSchedEnabled     bool
 	wmCmd                string
 	needQuickBlackScreen bool
+	launchBackend        string
+	autostartConcurrency int32
+	appLogMode           string
 }
 
 func getGSettingsConfig() *GSettingsConfig {
@@ -227,11 +232,26 @@ func getGSettingsConfig() *GSettingsConfig {
 		swapSchedEnabled:     gs.GetBoolean("swap-sched-enabled"),
 		wmCmd:                gs.GetString("wm-cmd"),
 		needQuickBlackScreen: gs.GetBoolean("quick-black-screen"),
+		launchBackend:        launchBackendCgexec,
+	}
+	// 兼容没有 launch-backend 键的旧 schema
+	if hasGSettingsKey(gs, gKeyLaunchBackend) {
+		cfg.launchBackend = gs.GetString(gKeyLaunchBackend)
+	}
+	if hasGSettingsKey(gs, gKeyAutostartConcurrency) {
+		cfg.autostartConcurrency = gs.GetInt(gKeyAutostartConcurrency)
+	}
+	if hasGSettingsKey(gs, gKeyAppLogMode) {
+		cfg.appLogMode = gs.GetString(gKeyAppLogMode)
 	}
 	gs.Unref()
 	return cfg
 }
 
+func hasGSettingsKey(gs *gio.Settings, key string) bool {
+	return strv.Strv(gs.ListKeys()).Contains(key)
+}
+
 func initGSettingsConfig() {
 	if _gSettingsConfig == nil {
 		_gSettingsConfig = getGSettingsConfig()
@@ -278,3 +298,15 @@ func getLightDMAutoLoginUser() (string, error) {
 	v, err := kf.GetString("Seat:*", "autologin-user")
 	return v, err
 }
+
+// getCgroupCmdPrefix 返回在 cgroup 中启动命令的命令前缀，
+// cgroup v1 使用 cgexec，cgroup v2 没有 cgexec 可用，由 shell 把自己写入 cgroup.procs 后再 exec 命令，
+// 写入失败时 shell 以状态 1 退出，错误输出到应用的标准错误，不在 cgroup 之外启动应用
+func getCgroupCmdPrefix(controllers, cgroupName string) []string {
+	if swapsched.IsUnifiedCgroup() {
+		script := "echo $$ >" + shellQuote(swapsched.GetCgroupProcsFile(cgroupName)) +
+			` || exit 1; exec "$@"`
+		return []string{"/bin/sh", "-c", script, "sh"}
+	}
+	return []string{globalCgExecBin, "-g", controllers + ":" + cgroupName}
+}